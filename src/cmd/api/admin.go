@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"fuzzy-search/internal/app/gutenbergsearch"
+	"fuzzy-search/internal/pkg/data"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ErrUnauthorized  = "unauthorized"
+	ErrCacheNotFound = "cache_not_found"
+	ErrBadPurge      = "bad_purge"
+)
+
+// pinnedCache is the cache in which books are pinned
+const pinnedCache = "content"
+
+// adminAuth allows requests with "Authorization: Bearer <token>" header only
+func adminAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(header, "Bearer ")
+		if given == header || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write(newError(ErrUnauthorized, "valid admin token is required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	content, _ := json.Marshal(value)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(content)
+}
+
+// namedCache returns cache of the name given in request path, or responds with an error
+func namedCache(caches map[string]gutenbergsearch.AdminCache, w http.ResponseWriter, r *http.Request) (gutenbergsearch.AdminCache, bool) {
+	name := mux.Vars(r)["name"]
+	cache, ok := caches[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write(newError(ErrCacheNotFound, fmt.Sprintf("cache '%s' does not exist", name)))
+	}
+	return cache, ok
+}
+
+// cacheStats responds with statistics of all caches
+func cacheStats(caches map[string]gutenbergsearch.AdminCache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := make(map[string]gutenbergsearch.CacheStats, len(caches))
+		for name, cache := range caches {
+			stats[name] = cache.Stats()
+		}
+		writeJSON(w, stats)
+	})
+}
+
+// cacheKeys responds with items of the cache, optionally narrowed down by "prefix" parameter
+func cacheKeys(caches map[string]gutenbergsearch.AdminCache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cache, ok := namedCache(caches, w, r)
+		if !ok {
+			return
+		}
+		prefix := r.URL.Query().Get("prefix")
+		items := []gutenbergsearch.CacheItem{}
+		for _, item := range cache.Items() {
+			if strings.HasPrefix(item.Key, prefix) {
+				items = append(items, item)
+			}
+		}
+		writeJSON(w, items)
+	})
+}
+
+// cachePurge deletes item of given "key", items of given "prefix", or all items with "all=1"
+func cachePurge(caches map[string]gutenbergsearch.AdminCache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cache, ok := namedCache(caches, w, r)
+		if !ok {
+			return
+		}
+
+		params := r.URL.Query()
+		var deleted int
+		switch {
+		case params.Get("key") != "":
+			if cache.Delete(params.Get("key")) {
+				deleted = 1
+			}
+		case params.Get("prefix") != "":
+			deleted = cache.DeletePrefix(params.Get("prefix"))
+		case stringToBoolFallback(params.Get("all"), false):
+			deleted = cache.Flush()
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(newError(ErrBadPurge, "one of 'key', 'prefix' or 'all=1' parameters is required"))
+			return
+		}
+		writeJSON(w, map[string]int{"deleted": deleted})
+	})
+}
+
+// bookPin pins (PUT) or unpins (DELETE) content of the book given by ebook ID, pinned books never expire
+func bookPin(caches map[string]gutenbergsearch.AdminCache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		books, err := data.BookQuery{IDs: []int{id}}.Books()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(newError(ErrBadBookQuery, err.Error()))
+			return
+		}
+
+		key := books[0].ID()
+		if r.Method == http.MethodDelete {
+			caches[pinnedCache].Unpin(key)
+		} else {
+			caches[pinnedCache].Pin(key)
+		}
+		writeJSON(w, map[string]interface{}{"key": key, "pinned": r.Method != http.MethodDelete})
+	})
+}
+
+// registerCacheAdmin adds cache management endpoints protected with admin token to the router
+func registerCacheAdmin(router *mux.Router, caches map[string]gutenbergsearch.AdminCache, token string) {
+	admin := router.PathPrefix("/admin/cache").Subrouter()
+	admin.Handle("", adminAuth(token, cacheStats(caches))).Methods(http.MethodGet)
+	admin.Handle("/pins/{id:[0-9]+}", adminAuth(token, bookPin(caches))).Methods(http.MethodPut, http.MethodDelete)
+	admin.Handle("/{name}/keys", adminAuth(token, cacheKeys(caches))).Methods(http.MethodGet)
+	admin.Handle("/{name}", adminAuth(token, cachePurge(caches))).Methods(http.MethodDelete)
+}
+
+// registerMetrics adds runtime metrics endpoint protected with admin token to the router
+func registerMetrics(router *mux.Router, token string) {
+	router.Handle("/debug/vars", adminAuth(token, expvar.Handler())).Methods(http.MethodGet)
+}
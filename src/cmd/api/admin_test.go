@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fuzzy-search/internal/app/gutenbergsearch"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "secret"
+
+func testAdminApp() (*httptest.Server, map[string]gutenbergsearch.AdminCache) {
+	caches := map[string]gutenbergsearch.AdminCache{
+		"answer":  gutenbergsearch.NewCache(false, time.Hour, time.Hour, 0),
+		"listing": gutenbergsearch.NewCache(true, time.Hour, time.Hour, 0),
+		"content": gutenbergsearch.NewCache(true, time.Hour, time.Hour, 0),
+	}
+	r := mux.NewRouter()
+	registerCacheAdmin(r, caches, testAdminToken)
+	registerMetrics(r, testAdminToken)
+	return httptest.NewServer(r), caches
+}
+
+func adminRequest(t *testing.T, method, url, token string, response interface{}) int {
+	request, err := http.NewRequest(method, url, nil)
+	assert.Nil(t, err)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := http.Client{Timeout: time.Second * 2}
+	res, err := client.Do(request)
+	if !assert.Nil(t, err) {
+		return 0
+	}
+	defer res.Body.Close()
+	if response != nil && res.StatusCode == http.StatusOK {
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(response))
+	}
+	return res.StatusCode
+}
+
+func Test_AdminCacheAuth(t *testing.T) {
+	ts, _ := testAdminApp()
+	defer ts.Close()
+
+	for _, header := range []string{"", "Bearer wrong", "Bearer Bearer " + testAdminToken, testAdminToken} {
+		t.Run(fmt.Sprintf("input:'%s'", header), func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, ts.URL+"/admin/cache", nil)
+			assert.Nil(t, err)
+			request.Header.Set("Authorization", header)
+
+			res, err := http.DefaultClient.Do(request)
+			if assert.Nil(t, err) {
+				res.Body.Close()
+				assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+			}
+		})
+	}
+}
+
+func Test_Metrics(t *testing.T) {
+	ts, _ := testAdminApp()
+	defer ts.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, http.MethodGet, ts.URL+"/debug/vars", "", nil))
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, http.MethodGet, ts.URL+"/debug/vars", "wrong", nil))
+
+	var metrics map[string]interface{}
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, ts.URL+"/debug/vars", testAdminToken, &metrics))
+	assert.Contains(t, metrics, "memstats")
+}
+
+func Test_AdminCache(t *testing.T) {
+	ts, caches := testAdminApp()
+	defer ts.Close()
+
+	content := caches["content"]
+	content.Set("/ebooks/1513", "Romeo and Juliet")
+	content.Set("/ebooks/1524", "Hamlet")
+	content.Set("index//ebooks/1513", []byte("index"))
+	content.Get("/ebooks/1513")
+	content.Get("/ebooks/84")
+
+	var stats map[string]gutenbergsearch.CacheStats
+	status := adminRequest(t, http.MethodGet, ts.URL+"/admin/cache", testAdminToken, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, gutenbergsearch.CacheStats{Items: 3, Bytes: 27, Hits: 1, Misses: 1}, stats["content"])
+	assert.Equal(t, gutenbergsearch.CacheStats{}, stats["answer"])
+
+	var items []gutenbergsearch.CacheItem
+	status = adminRequest(t, http.MethodGet, ts.URL+"/admin/cache/content/keys?prefix=/ebooks/", testAdminToken, &items)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, "/ebooks/1513", items[0].Key)
+		assert.Equal(t, 16, items[0].Size)
+		assert.False(t, items[0].Expires.IsZero())
+	}
+
+	status = adminRequest(t, http.MethodPut, ts.URL+"/admin/cache/pins/1513", testAdminToken, nil)
+	assert.Equal(t, http.StatusOK, status)
+	adminRequest(t, http.MethodGet, ts.URL+"/admin/cache/content/keys?prefix=/ebooks/1513", testAdminToken, &items)
+	if assert.Len(t, items, 1) {
+		assert.True(t, items[0].Pinned)
+		assert.True(t, items[0].Expires.IsZero())
+	}
+
+	type testCase struct {
+		query    string
+		status   int
+		expected int
+	}
+
+	testCases := []testCase{
+		{query: "", status: http.StatusBadRequest},
+		{query: "?key=/ebooks/84", status: http.StatusOK, expected: 0},
+		{query: "?key=/ebooks/1524", status: http.StatusOK, expected: 1},
+		{query: "?prefix=index/", status: http.StatusOK, expected: 1},
+		{query: "?all=1", status: http.StatusOK, expected: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.query), func(t *testing.T) {
+			var deleted map[string]int
+			status := adminRequest(t, http.MethodDelete, ts.URL+"/admin/cache/content"+tc.query, testAdminToken, &deleted)
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.expected, deleted["deleted"])
+		})
+	}
+	assert.Empty(t, content.Items())
+
+	status = adminRequest(t, http.MethodDelete, ts.URL+"/admin/cache/unknown?all=1", testAdminToken, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -6,6 +6,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"fuzzy-search/internal/pkg/data"
+	search2 "fuzzy-search/internal/pkg/search"
 )
 
 func stringToBool(s string) (bool, error) {
@@ -125,32 +128,110 @@ func stringToIntFallback(s string, fallback int) int {
 	return value
 }
 
+// stringToListFallback splits comma separated list, empty entries are skipped
+func stringToListFallback(s string, fallback []string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		return fallback
+	}
+	return list
+}
+
+func stringToIntListFallback(s string, fallback []int) []int {
+	var list []int
+	for _, item := range stringToListFallback(s, nil) {
+		value, err := strconv.Atoi(item)
+		if err != nil {
+			return fallback
+		}
+		list = append(list, value)
+	}
+	if len(list) == 0 {
+		return fallback
+	}
+	return list
+}
+
+func stringToFloatFallback(s string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
 type Config struct {
 	serverReadTimeout  time.Duration
 	serverWriteTimeout time.Duration
+	adminToken         string // bearer token of admin endpoints, admin endpoints are disabled if empty
+
+	cacheRedisAddr     string        // address of Redis server keeping enabled caches, in-memory caches are used if empty
+	cacheRedisPassword string        // optional password of Redis server
+	cacheRedisDB       int           // Redis database number
+	cacheRedisPrefix   string        // prefix of keys of all caches, replicas of the same prefix share cached values
+	cacheRedisTimeout  time.Duration // Redis command timeout
+	cacheRedisCompress bool          // gzip compress cached content in Redis
 
 	answerCache                bool // enable/disable cache based on query sent to application and it's answer
 	answerCacheExpiration      time.Duration
 	answerCacheCleanupInterval time.Duration
+	answerCacheMaxBytes        int64 // memory budget of the cache, the least recently used items are evicted over it
 
 	listingCache                bool // enable/disable cache for listing metadata for given "title" part of query
 	listingCacheExpiration      time.Duration
 	listingCacheCleanupInterval time.Duration
+	listingCacheMaxBytes        int64
 
 	contentCache                bool // enable/disable cache for downloaded content (strongly suggested)
 	contentCacheExpiration      time.Duration
 	contentCacheCleanupInterval time.Duration
-
-	downloadDelayMin time.Duration // download Task limitation to emulate human-like behaviour to prevent from banning.
-	downloadDelayMax time.Duration // min/max value, each download gets random value from that range
-
+	contentCacheMaxBytes        int64
+	contentCacheMaxAge          time.Duration // content older than that is revalidated with conditional request
+
+	indexCache                bool // enable/disable cache for search indexes of "suffixarray" engine
+	indexCacheExpiration      time.Duration
+	indexCacheCleanupInterval time.Duration
+	indexCacheMaxBytes        int64
+
+	downloadWorkers       int           // books downloaded in parallel, shared by all searches
+	downloadAttempts      int           // download attempts of a book, permanent failures (eg. missing book) are not retried
+	downloadRetryDelay    time.Duration // backoff before the first retry, doubled with every next one
+	downloadRetryMaxDelay time.Duration // maximum backoff, downloads throttled for a longer time are given up
+
+	warmupIDs        []int         // ebook IDs prefetched into content cache
+	warmupPopular    int           // number of the most downloaded Gutenberg books prefetched into content cache
+	warmupTopQueries int           // number of the most frequent book queries whose books are prefetched
+	warmupInterval   time.Duration // prefetch is repeated with the interval, 0 prefetches on startup only
+
+	searchEngine       string        // search engine implementation: "fuzzy", "suffixarray" or "stream"
+	searchChunkSize    int           // size of chunks in bytes read by "stream" search engine
 	searchWorkers      int           // search worker goroutines (inefficient without cached content)
 	searchMaxDistance  int           // fuzzy-search engine distance option
+	searchMaxTotal     int           // maximum summed distance of phrase words, negative value disables the limit
+	searchMaxRelative  float64       // maximum word distance relative to its length, 0 disables the limit
+	searchMinMatched   float64       // fraction of phrase words that has to match
+	searchStopWords    string        // stop words handling: "match", "exact" or "ignore"
+	searchLanguage     string        // language of stop words list
 	searchRandomResult bool          // returns a random match in the scope of given book instead of a first found match [Note: cannot work properly with with CACHE_ANSWER enabled]
 	searchTimeout      time.Duration // maximum time allowed to spent by server for each search request
-
-	providerUserAgent string        // user-agent header used for provider's requests
-	providerTimeout   time.Duration // provider http client timeout
+	searchMaxBookIDs   int           // maximum number of ebook IDs searched by a single request
+
+	providerUserAgent   string        // user-agent header used for provider's requests
+	providerTimeout     time.Duration // provider http client timeout
+	providerMaxPages    int           // number of search result pages read for a title (25 results per page)
+	providerMaxResults  int           // maximum number of books read for a title, 0 disables the limit
+	providerMirrors     []string      // website mirrors tried in order, unhealthy ones are failed over
+	providerFileMirrors []string      // rsync file tree mirrors (http or file urls) preferred for downloads
+	providerLocalDirs   []string      // directories of local books queried before Gutenberg, in order
+	providerCompression bool          // download zipped editions and accept gzip encoded responses
+	providerRateLimit   float64       // requests per second sent to remote mirrors, 0 disables the limit
+	providerRateBurst   int           // requests sent at once before the rate limit applies
+	providerRobots      bool          // honor robots.txt of remote mirrors, including Crawl-delay
 }
 
 func GetDefaultConfig() *Config {
@@ -158,28 +239,64 @@ func GetDefaultConfig() *Config {
 		serverReadTimeout:  time.Minute * 2,
 		serverWriteTimeout: time.Minute * 2,
 
+		cacheRedisAddr:     "",
+		cacheRedisDB:       0,
+		cacheRedisPrefix:   "fuzzy-search:",
+		cacheRedisTimeout:  time.Second * 2,
+		cacheRedisCompress: true,
+
 		answerCache:                true,
 		answerCacheExpiration:      time.Hour * 4,
 		answerCacheCleanupInterval: time.Minute * 31,
+		answerCacheMaxBytes:        0,
 
 		listingCache:                true,
 		listingCacheExpiration:      time.Hour * 4,
 		listingCacheCleanupInterval: time.Minute * 10,
+		listingCacheMaxBytes:        0,
 
 		contentCache:                true,
-		contentCacheExpiration:      time.Hour,
+		contentCacheExpiration:      time.Hour * 24,
 		contentCacheCleanupInterval: time.Minute * 10,
+		contentCacheMaxBytes:        1 << 30,
+		contentCacheMaxAge:          time.Hour,
 
-		downloadDelayMin: time.Second,
-		downloadDelayMax: time.Second * 2,
+		indexCache:                true,
+		indexCacheExpiration:      time.Hour * 24,
+		indexCacheCleanupInterval: time.Minute * 10,
+		indexCacheMaxBytes:        1 << 29,
 
+		downloadWorkers:       2,
+		downloadAttempts:      3,
+		downloadRetryDelay:    time.Second,
+		downloadRetryMaxDelay: time.Second * 30,
+
+		warmupPopular:    0,
+		warmupTopQueries: 0,
+		warmupInterval:   time.Hour * 6,
+
+		searchEngine:       "fuzzy",
+		searchChunkSize:    64 * 1024,
 		searchWorkers:      8,
 		searchMaxDistance:  2,
+		searchMaxTotal:     -1,
+		searchMaxRelative:  0,
+		searchMinMatched:   1,
+		searchStopWords:    search2.StopWordsExact,
+		searchLanguage:     search2.DefaultLanguage,
 		searchRandomResult: false,
 		searchTimeout:      time.Minute * 2,
-
-		providerUserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:80.0) Gecko/20100101 Firefox/80.0",
-		providerTimeout:   time.Second * 30,
+		searchMaxBookIDs:   25,
+
+		providerUserAgent:   "fuzzy-search/1.0 (Project Gutenberg phrase search service)",
+		providerTimeout:     time.Second * 30,
+		providerMaxPages:    1,
+		providerMaxResults:  0,
+		providerMirrors:     []string{data.DefaultMirror},
+		providerCompression: true,
+		providerRateLimit:   0.5,
+		providerRateBurst:   2,
+		providerRobots:      false,
 	}
 }
 
@@ -187,28 +304,93 @@ func GetConfig() *Config {
 	defaultCfg := GetDefaultConfig()
 	cfg := &Config{}
 
+	cfg.adminToken = os.Getenv("ADMIN_TOKEN")
+
+	cfg.cacheRedisAddr = stringFallback(os.Getenv("CACHE_REDIS_ADDR"), defaultCfg.cacheRedisAddr)
+	cfg.cacheRedisPassword = os.Getenv("CACHE_REDIS_PASSWORD")
+	cfg.cacheRedisDB = stringToIntFallback(os.Getenv("CACHE_REDIS_DB"), defaultCfg.cacheRedisDB)
+	cfg.cacheRedisPrefix = stringFallback(os.Getenv("CACHE_REDIS_PREFIX"), defaultCfg.cacheRedisPrefix)
+	cfg.cacheRedisTimeout = stringToDurationFallback(os.Getenv("CACHE_REDIS_TIMEOUT"), defaultCfg.cacheRedisTimeout)
+	cfg.cacheRedisCompress = stringToBoolFallback(os.Getenv("CACHE_REDIS_COMPRESSION"), defaultCfg.cacheRedisCompress)
+
 	cfg.answerCache = stringToBoolFallback(os.Getenv("CACHE_ANSWER"), defaultCfg.answerCache)
 	cfg.answerCacheExpiration = stringToDurationFallback(os.Getenv("CACHE_ANSWER_EXPIRATION"), defaultCfg.answerCacheExpiration)
 	cfg.answerCacheCleanupInterval = stringToDurationFallback(os.Getenv("CACHE_ANSWER_CLEANUP_INTERVAL"), defaultCfg.answerCacheCleanupInterval)
+	cfg.answerCacheMaxBytes = int64(stringToIntFallback(os.Getenv("CACHE_ANSWER_MAX_BYTES"), int(defaultCfg.answerCacheMaxBytes)))
 
 	cfg.listingCache = stringToBoolFallback(os.Getenv("CACHE_LISTING"), defaultCfg.listingCache)
 	cfg.listingCacheExpiration = stringToDurationFallback(os.Getenv("CACHE_LISTING_EXPIRATION"), defaultCfg.listingCacheExpiration)
 	cfg.listingCacheCleanupInterval = stringToDurationFallback(os.Getenv("CACHE_LISTING_CLEANUP_INTERVAL"), defaultCfg.listingCacheCleanupInterval)
+	cfg.listingCacheMaxBytes = int64(stringToIntFallback(os.Getenv("CACHE_LISTING_MAX_BYTES"), int(defaultCfg.listingCacheMaxBytes)))
 
 	cfg.contentCache = stringToBoolFallback(os.Getenv("CACHE_CONTENT"), defaultCfg.contentCache)
 	cfg.contentCacheExpiration = stringToDurationFallback(os.Getenv("CACHE_CONTENT_EXPIRATION"), defaultCfg.contentCacheExpiration)
 	cfg.contentCacheCleanupInterval = stringToDurationFallback(os.Getenv("CACHE_CONTENT_CLEANUP_INTERVAL"), defaultCfg.contentCacheCleanupInterval)
-
-	cfg.downloadDelayMin = stringToDurationFallback(os.Getenv("DOWNLOAD_DELAY_MIN"), defaultCfg.downloadDelayMin)
-	cfg.downloadDelayMax = stringToDurationFallback(os.Getenv("DOWNLOAD_DELAY_MAX"), defaultCfg.downloadDelayMax)
-
+	cfg.contentCacheMaxBytes = int64(stringToIntFallback(os.Getenv("CACHE_CONTENT_MAX_BYTES"), int(defaultCfg.contentCacheMaxBytes)))
+	cfg.contentCacheMaxAge = stringToDurationFallback(os.Getenv("CACHE_CONTENT_MAX_AGE"), defaultCfg.contentCacheMaxAge)
+
+	cfg.indexCache = stringToBoolFallback(os.Getenv("CACHE_INDEX"), defaultCfg.indexCache)
+	cfg.indexCacheExpiration = stringToDurationFallback(os.Getenv("CACHE_INDEX_EXPIRATION"), defaultCfg.indexCacheExpiration)
+	cfg.indexCacheCleanupInterval = stringToDurationFallback(os.Getenv("CACHE_INDEX_CLEANUP_INTERVAL"), defaultCfg.indexCacheCleanupInterval)
+	cfg.indexCacheMaxBytes = int64(stringToIntFallback(os.Getenv("CACHE_INDEX_MAX_BYTES"), int(defaultCfg.indexCacheMaxBytes)))
+
+	cfg.downloadWorkers = stringToIntFallback(os.Getenv("DOWNLOAD_WORKERS"), defaultCfg.downloadWorkers)
+	cfg.downloadAttempts = stringToIntFallback(os.Getenv("DOWNLOAD_ATTEMPTS"), defaultCfg.downloadAttempts)
+	cfg.downloadRetryDelay = stringToDurationFallback(os.Getenv("DOWNLOAD_RETRY_DELAY"), defaultCfg.downloadRetryDelay)
+	cfg.downloadRetryMaxDelay = stringToDurationFallback(os.Getenv("DOWNLOAD_RETRY_MAX_DELAY"), defaultCfg.downloadRetryMaxDelay)
+	cfg.warmupIDs = stringToIntListFallback(os.Getenv("WARMUP_IDS"), defaultCfg.warmupIDs)
+	cfg.warmupPopular = stringToIntFallback(os.Getenv("WARMUP_POPULAR"), defaultCfg.warmupPopular)
+	cfg.warmupTopQueries = stringToIntFallback(os.Getenv("WARMUP_TOP_QUERIES"), defaultCfg.warmupTopQueries)
+	cfg.warmupInterval = stringToDurationFallback(os.Getenv("WARMUP_INTERVAL"), defaultCfg.warmupInterval)
+
+	cfg.searchEngine = stringFallback(os.Getenv("SEARCH_ENGINE"), defaultCfg.searchEngine)
+	cfg.searchChunkSize = stringToIntFallback(os.Getenv("SEARCH_CHUNK_SIZE"), defaultCfg.searchChunkSize)
 	cfg.searchWorkers = stringToIntFallback(os.Getenv("SEARCH_WORKERS"), defaultCfg.searchWorkers)
 	cfg.searchMaxDistance = stringToIntFallback(os.Getenv("SEARCH_MAX_DISTANCE"), defaultCfg.searchMaxDistance)
+	cfg.searchMaxTotal = stringToIntFallback(os.Getenv("SEARCH_MAX_TOTAL_DISTANCE"), defaultCfg.searchMaxTotal)
+	cfg.searchMaxRelative = stringToFloatFallback(os.Getenv("SEARCH_MAX_RELATIVE_DISTANCE"), defaultCfg.searchMaxRelative)
+	cfg.searchMinMatched = stringToFloatFallback(os.Getenv("SEARCH_MIN_MATCHED_FRACTION"), defaultCfg.searchMinMatched)
+	cfg.searchStopWords = stringFallback(os.Getenv("SEARCH_STOP_WORDS"), defaultCfg.searchStopWords)
+	cfg.searchLanguage = stringFallback(os.Getenv("SEARCH_LANGUAGE"), defaultCfg.searchLanguage)
 	cfg.searchRandomResult = stringToBoolFallback(os.Getenv("SEARCH_RANDOM_RESULT"), defaultCfg.searchRandomResult)
 	cfg.searchTimeout = stringToDurationFallback(os.Getenv("SEARCH_TIMEOUT"), defaultCfg.searchTimeout)
+	cfg.searchMaxBookIDs = stringToIntFallback(os.Getenv("SEARCH_MAX_BOOK_IDS"), defaultCfg.searchMaxBookIDs)
 
 	cfg.providerUserAgent = stringFallback(os.Getenv("PROVIDER_USER_AGENT"), defaultCfg.providerUserAgent)
 	cfg.providerTimeout = stringToDurationFallback(os.Getenv("PROVIDER_TIMEOUT"), defaultCfg.providerTimeout)
+	cfg.providerMaxPages = stringToIntFallback(os.Getenv("PROVIDER_MAX_PAGES"), defaultCfg.providerMaxPages)
+	cfg.providerMaxResults = stringToIntFallback(os.Getenv("PROVIDER_MAX_RESULTS"), defaultCfg.providerMaxResults)
+	cfg.providerMirrors = stringToListFallback(os.Getenv("PROVIDER_MIRRORS"), defaultCfg.providerMirrors)
+	cfg.providerFileMirrors = stringToListFallback(os.Getenv("PROVIDER_FILE_MIRRORS"), defaultCfg.providerFileMirrors)
+	cfg.providerLocalDirs = stringToListFallback(os.Getenv("PROVIDER_LOCAL_DIRS"), defaultCfg.providerLocalDirs)
+	cfg.providerCompression = stringToBoolFallback(os.Getenv("PROVIDER_COMPRESSION"), defaultCfg.providerCompression)
+	cfg.providerRateLimit = stringToFloatFallback(os.Getenv("PROVIDER_RATE_LIMIT"), defaultCfg.providerRateLimit)
+	cfg.providerRateBurst = stringToIntFallback(os.Getenv("PROVIDER_RATE_BURST"), defaultCfg.providerRateBurst)
+	cfg.providerRobots = stringToBoolFallback(os.Getenv("PROVIDER_ROBOTS"), defaultCfg.providerRobots)
 
 	return cfg
 }
+
+// redacted returns copy of the config which can be logged, secrets are masked
+func (c *Config) redacted() Config {
+	redacted := *c
+	if redacted.adminToken != "" {
+		redacted.adminToken = "[redacted]"
+	}
+	if redacted.cacheRedisPassword != "" {
+		redacted.cacheRedisPassword = "[redacted]"
+	}
+	return redacted
+}
+
+// searchOptions returns default search options, they can be overridden by each request
+func (c *Config) searchOptions() search2.Options {
+	return search2.Options{
+		MaxDistance:         c.searchMaxDistance,
+		MaxTotalDistance:    c.searchMaxTotal,
+		MaxRelativeDistance: c.searchMaxRelative,
+		MinMatchedFraction:  c.searchMinMatched,
+		StopWords:           c.searchStopWords,
+		Language:            c.searchLanguage,
+	}
+}
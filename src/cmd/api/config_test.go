@@ -103,3 +103,13 @@ func Test_stringToBoolErrors(t *testing.T) {
 		})
 	}
 }
+
+func Test_configRedacted(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.adminToken = "secret"
+	cfg.cacheRedisPassword = "secret"
+
+	logged := fmt.Sprintf("%#v", cfg.redacted())
+	assert.NotContains(t, logged, "secret")
+	assert.Equal(t, "secret", cfg.adminToken)
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -21,9 +22,178 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// bookIDs accepts both a single ebook ID and a list of them, duplicate IDs are removed
+type bookIDs []int
+
+func (b *bookIDs) UnmarshalJSON(data []byte) error {
+	var id int
+	if err := json.Unmarshal(data, &id); err == nil {
+		*b = bookIDs{id}
+		return nil
+	}
+
+	var ids []int
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return errors.New("book_id has to be a number or a list of numbers")
+	}
+	seen := make(map[int]bool, len(ids))
+	*b = make(bookIDs, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			*b = append(*b, id)
+		}
+	}
+	return nil
+}
+
 type Payload struct {
-	Title  *string `json:"title"`
-	Phrase *string `json:"phrase"`
+	Title  *string  `json:"title"`
+	Phrase *string  `json:"phrase"`
+	BookID *bookIDs `json:"book_id"` // alternative to title, books are looked up directly
+
+	// optional book filters, title can be omitted when author, subject or bookshelf is provided
+	Author       *string `json:"author"`
+	Subject      *string `json:"subject"`
+	BookLanguage *string `json:"book_language"`
+	Bookshelf    *int    `json:"bookshelf"`
+	MinID        *int    `json:"min_id"`
+	MaxID        *int    `json:"max_id"`
+
+	// optional thresholds, defaults are taken from config
+	MaxDistance         *int     `json:"max_distance"`
+	MaxTotalDistance    *int     `json:"max_total_distance"`
+	MaxRelativeDistance *float64 `json:"max_relative_distance"`
+	MinMatchedFraction  *float64 `json:"min_matched_fraction"`
+	StopWords           *string  `json:"stop_words"`
+	Language            *string  `json:"language"`
+}
+
+// bookQuery returns criteria of books to search in
+func (p *Payload) bookQuery() data.BookQuery {
+	var query data.BookQuery
+	if p.Title != nil {
+		query.Title = *p.Title
+	}
+	if p.Author != nil {
+		query.Author = *p.Author
+	}
+	if p.Subject != nil {
+		query.Subject = *p.Subject
+	}
+	if p.BookLanguage != nil {
+		query.Language = *p.BookLanguage
+	}
+	if p.Bookshelf != nil {
+		query.Bookshelf = *p.Bookshelf
+	}
+	if p.MinID != nil {
+		query.MinID = *p.MinID
+	}
+	if p.MaxID != nil {
+		query.MaxID = *p.MaxID
+	}
+	if p.BookID != nil {
+		query.IDs = *p.BookID
+	}
+	return query
+}
+
+// searchOptions returns search options of payload, not provided values are taken from defaults
+func (p *Payload) searchOptions(defaults search2.Options) search2.Options {
+	options := defaults
+	if p.MaxDistance != nil {
+		options.MaxDistance = *p.MaxDistance
+	}
+	if p.MaxTotalDistance != nil {
+		options.MaxTotalDistance = *p.MaxTotalDistance
+	}
+	if p.MaxRelativeDistance != nil {
+		options.MaxRelativeDistance = *p.MaxRelativeDistance
+	}
+	if p.MinMatchedFraction != nil {
+		options.MinMatchedFraction = *p.MinMatchedFraction
+	}
+	if p.StopWords != nil {
+		options.StopWords = *p.StopWords
+	}
+	if p.Language != nil {
+		options.Language = *p.Language
+	}
+	return options
+}
+
+type Options struct {
+	MaxDistance         int     `json:"max_distance"`
+	MaxTotalDistance    int     `json:"max_total_distance"`
+	MaxRelativeDistance float64 `json:"max_relative_distance"`
+	MinMatchedFraction  float64 `json:"min_matched_fraction"`
+	StopWords           string  `json:"stop_words"`
+	Language            string  `json:"language"`
+}
+
+type Format struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type Book struct {
+	ID          int      `json:"id,omitempty"`
+	Title       string   `json:"title"`
+	Author      string   `json:"author"`
+	Language    string   `json:"language,omitempty"`
+	Subjects    []string `json:"subjects,omitempty"`
+	ReleaseDate string   `json:"release_date,omitempty"`
+	Downloads   int      `json:"downloads,omitempty"`
+	Formats     []Format `json:"formats,omitempty"`
+	CoverURL    string   `json:"cover_url,omitempty"`
+}
+
+func newBook(book data.Book) Book {
+	id, _ := book.EbookID()
+	msg := Book{
+		ID:          id,
+		Title:       book.Title,
+		Author:      book.Author,
+		Language:    book.Language,
+		Subjects:    book.Subjects,
+		ReleaseDate: book.ReleaseDate,
+		Downloads:   book.Downloads,
+		CoverURL:    book.CoverURL,
+	}
+	for _, format := range book.Formats {
+		msg.Formats = append(msg.Formats, Format{
+			Name: format.Name,
+			Type: format.Type,
+			URL:  format.URL,
+		})
+	}
+	return msg
+}
+
+// AnswerMessage is returned to clients accepting application/json
+type AnswerMessage struct {
+	Result  string  `json:"result"`
+	Options Options `json:"options"`
+	Book    Book    `json:"book"`
+}
+
+func newAnswer(answer gutenbergsearch.Answer) []byte {
+	msg := AnswerMessage{
+		Result: answer.Result,
+		Book:   newBook(answer.Book),
+		Options: Options{
+			MaxDistance:         answer.Options.MaxDistance,
+			MaxTotalDistance:    answer.Options.MaxTotalDistance,
+			MaxRelativeDistance: answer.Options.MaxRelativeDistance,
+			MinMatchedFraction:  answer.Options.MinMatchedFraction,
+			StopWords:           answer.Options.StopWords,
+			Language:            answer.Options.Language,
+		},
+	}
+	data, _ := json.Marshal(msg)
+	return data
 }
 
 type ErrorMessage struct {
@@ -43,11 +213,16 @@ func newError(code, message string) []byte {
 const (
 	ErrMissingFiled   = "missing_filed"
 	ErrJSONParse      = "bad_payload"
+	ErrBadOption      = "bad_option"
+	ErrBadBookQuery   = "bad_book_query"
 	ErrServerError    = "request_failed"
 	ErrPhraseNotFound = "phrase_not_found"
+	ErrBooksNotFound  = "books_not_found"
+	ErrDisallowed     = "crawl_disallowed"
 )
 
-func search(searchService gutenbergsearch.Searcher) http.Handler {
+// search handles search requests, maxBookIDs limits number of ebook IDs searched by a single request
+func search(searchService gutenbergsearch.Searcher, defaultOptions search2.Options, maxBookIDs int) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var payload Payload
 
@@ -68,10 +243,12 @@ func search(searchService gutenbergsearch.Searcher) http.Handler {
 			return
 		}
 
-		if payload.Phrase == nil || payload.Title == nil {
+		hasBookFilters := payload.Author != nil || payload.Subject != nil || payload.Bookshelf != nil ||
+			payload.BookID != nil
+		if payload.Phrase == nil || (payload.Title == nil && !hasBookFilters) {
 			var missingFields []string
 
-			if payload.Title == nil {
+			if payload.Title == nil && !hasBookFilters {
 				missingFields = append(missingFields, "'title'")
 			}
 			if payload.Phrase == nil {
@@ -85,14 +262,21 @@ func search(searchService gutenbergsearch.Searcher) http.Handler {
 		}
 
 		var emptyFields []string
-		for field, value := range map[string]string{
-			"title":  *payload.Title,
-			"phrase": *payload.Phrase,
+		for field, value := range map[string]*string{
+			"title":         payload.Title,
+			"phrase":        payload.Phrase,
+			"author":        payload.Author,
+			"subject":       payload.Subject,
+			"book_language": payload.BookLanguage,
 		} {
-			if value == "" {
+			if value != nil && *value == "" {
 				emptyFields = append(emptyFields, field)
 			}
 		}
+		if payload.BookID != nil && len(*payload.BookID) == 0 {
+			emptyFields = append(emptyFields, "book_id")
+		}
+		sort.Strings(emptyFields)
 		if len(emptyFields) > 0 {
 			fields := strings.Join(emptyFields, ", ")
 			w.WriteHeader(http.StatusBadRequest)
@@ -101,14 +285,63 @@ func search(searchService gutenbergsearch.Searcher) http.Handler {
 			return
 		}
 
+		if payload.BookID != nil {
+			if payload.Title != nil || payload.Author != nil || payload.Subject != nil || payload.BookLanguage != nil ||
+				payload.Bookshelf != nil || payload.MinID != nil || payload.MaxID != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(newError(ErrBadBookQuery, "book_id cannot be combined with other book filters"))
+				return
+			}
+			if len(*payload.BookID) > maxBookIDs {
+				w.WriteHeader(http.StatusBadRequest)
+				message := fmt.Sprintf("book_id accepts at most %d ebook IDs", maxBookIDs)
+				_, _ = w.Write(newError(ErrBadBookQuery, message))
+				return
+			}
+			for _, id := range *payload.BookID {
+				if id < 1 {
+					w.WriteHeader(http.StatusBadRequest)
+					message := fmt.Sprintf("invalid book_id: %d", id)
+					_, _ = w.Write(newError(ErrBadBookQuery, message))
+					return
+				}
+			}
+		}
+
+		if err := payload.bookQuery().Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(newError(ErrBadBookQuery, err.Error()))
+			return
+		}
+
+		options := payload.searchOptions(defaultOptions)
+		if err := options.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(newError(ErrBadOption, err.Error()))
+			return
+		}
+
 		// Search() could receive request context for processing cancellation purpose
-		result, err := searchService.Search(*payload.Title, *payload.Phrase)
+		answer, err := searchService.Search(gutenbergsearch.Query{
+			Books:   payload.bookQuery(),
+			Phrase:  *payload.Phrase,
+			Options: options,
+		})
 		if err != nil {
+			var disallowed *data.DisallowedError
 			switch {
+			case errors.As(err, &disallowed):
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write(newError(ErrDisallowed, err.Error()))
+				return
 			case errors.Is(err, gutenbergsearch.ErrPhraseNotFound):
 				w.WriteHeader(http.StatusNotFound)
 				_, _ = w.Write(newError(ErrPhraseNotFound, "given phrase not found in books that matches given title"))
 				return
+			case errors.Is(err, gutenbergsearch.ErrNoBooks):
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write(newError(ErrBooksNotFound, "no books match given book query"))
+				return
 			case errors.Is(err, gutenbergsearch.ErrTooLong):
 				w.WriteHeader(http.StatusInternalServerError)
 				_, _ = w.Write(newError(ErrServerError, "requested processing exceeded allowed time"))
@@ -121,27 +354,112 @@ func search(searchService gutenbergsearch.Searcher) http.Handler {
 			return
 		}
 
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(newAnswer(answer))
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(result))
+		_, _ = w.Write([]byte(answer.Result))
 		return
 	})
 }
 
-func prepareSearchService(cfg *Config) gutenbergsearch.Searcher {
-	answerCache := gutenbergsearch.NewCache(cfg.answerCache, time.Hour*4, time.Minute*31)
-	listingCache := gutenbergsearch.NewCache(cfg.listingCache, time.Hour*4, time.Minute*10)
-	contentCache := gutenbergsearch.NewCache(cfg.contentCache, time.Hour, time.Minute*10)
+func prepareSearchEngine(cfg *Config, indexCache gutenbergsearch.Cache) search2.Searcher {
+	switch cfg.searchEngine {
+	case "suffixarray":
+		indexStore := gutenbergsearch.NewIndexStore(indexCache)
+		return search2.NewIndexSearcher(cfg.searchRandomResult, indexStore)
+	case "stream":
+		return search2.NewStreamSearcher(cfg.searchRandomResult, cfg.searchChunkSize)
+	default:
+		return search2.NewSearcher(cfg.searchRandomResult)
+	}
+}
+
+// prepareCaches returns answer, listing, content and index caches by their names, enabled caches are kept in Redis if
+// redisClient is given
+func prepareCaches(cfg *Config, redisClient *gutenbergsearch.RedisClient) map[string]gutenbergsearch.AdminCache {
+	if redisClient != nil {
+		redisCache := func(enabled bool, name string, expiration time.Duration, compress bool) gutenbergsearch.AdminCache {
+			if !enabled {
+				return gutenbergsearch.NewCache(false, 0, 0, 0)
+			}
+			return gutenbergsearch.NewRedisCache(redisClient, cfg.cacheRedisPrefix+name+":", expiration, compress)
+		}
+		return map[string]gutenbergsearch.AdminCache{
+			"answer":  redisCache(cfg.answerCache, "answer", cfg.answerCacheExpiration, false),
+			"listing": redisCache(cfg.listingCache, "listing", cfg.listingCacheExpiration, false),
+			"content": redisCache(cfg.contentCache, "content", cfg.contentCacheExpiration, cfg.cacheRedisCompress),
+			"index":   redisCache(cfg.indexCache, "index", cfg.indexCacheExpiration, cfg.cacheRedisCompress),
+		}
+	}
+
+	return map[string]gutenbergsearch.AdminCache{
+		"answer": gutenbergsearch.NewCache(cfg.answerCache, cfg.answerCacheExpiration, cfg.answerCacheCleanupInterval,
+			cfg.answerCacheMaxBytes),
+		"listing": gutenbergsearch.NewCache(cfg.listingCache, cfg.listingCacheExpiration, cfg.listingCacheCleanupInterval,
+			cfg.listingCacheMaxBytes),
+		"content": gutenbergsearch.NewCache(cfg.contentCache, cfg.contentCacheExpiration, cfg.contentCacheCleanupInterval,
+			cfg.contentCacheMaxBytes),
+		"index": gutenbergsearch.NewCache(cfg.indexCache, cfg.indexCacheExpiration, cfg.indexCacheCleanupInterval,
+			cfg.indexCacheMaxBytes),
+	}
+}
+
+func prepareSearchService(cfg *Config, caches map[string]gutenbergsearch.AdminCache) (gutenbergsearch.Searcher, error) {
+	gutenbergProvider, err := data.NewProvider(data.ProviderConfig{
+		UserAgent:   cfg.providerUserAgent,
+		Timeout:     cfg.providerTimeout,
+		MaxPages:    cfg.providerMaxPages,
+		MaxResults:  cfg.providerMaxResults,
+		Mirrors:     cfg.providerMirrors,
+		FileMirrors: cfg.providerFileMirrors,
+		Compression: cfg.providerCompression,
+		RateLimit:   cfg.providerRateLimit,
+		RateBurst:   cfg.providerRateBurst,
+		Robots:      cfg.providerRobots,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("preparing data provider failed: %w", err)
+	}
+
+	var providers []data.Provider
+	for _, dir := range cfg.providerLocalDirs {
+		localProvider, err := data.NewLocalProvider(dir)
+		if err != nil {
+			return nil, fmt.Errorf("preparing local data provider failed: %w", err)
+		}
+		providers = append(providers, localProvider)
+	}
+	dataProvider := data.NewChainProvider(append(providers, gutenbergProvider)...)
+
+	answerCache, listingCache, contentCache := caches["answer"], caches["listing"], caches["content"]
 
 	return gutenbergsearch.NewSearcher(
 		8,
 		answerCache,
 		listingCache,
 		contentCache,
-		data.NewProvider(cfg.providerUserAgent, cfg.providerTimeout),
+		dataProvider,
 		context.NewProvider(),
-		search2.NewSearcher(cfg.searchMaxDistance, cfg.searchRandomResult),
-		[2]time.Duration{cfg.downloadDelayMin, cfg.downloadDelayMax},
-	)
+		prepareSearchEngine(cfg, caches["index"]),
+		cfg.downloadWorkers,
+		gutenbergsearch.RetryPolicy{
+			Attempts:  cfg.downloadAttempts,
+			BaseDelay: cfg.downloadRetryDelay,
+			MaxDelay:  cfg.downloadRetryMaxDelay,
+		},
+		cfg.contentCacheMaxAge,
+		gutenbergsearch.WarmupConfig{
+			IDs:        cfg.warmupIDs,
+			Popular:    cfg.warmupPopular,
+			TopQueries: cfg.warmupTopQueries,
+			Interval:   cfg.warmupInterval,
+		},
+	), nil
 }
 
 func main() {
@@ -157,9 +475,28 @@ func main() {
 
 	cfg := GetConfig()
 	log.Printf("Loaded config:")
-	log.Printf("%#v", cfg)
+	log.Printf("%#v", cfg.redacted())
+	defaultOptions := cfg.searchOptions()
+	if err := defaultOptions.Validate(); err != nil {
+		log.Fatalf("Invalid configuration of search options: %s", err)
+	}
 
-	searchService := prepareSearchService(cfg)
+	var redisClient *gutenbergsearch.RedisClient
+	if cfg.cacheRedisAddr != "" {
+		var err error
+		redisClient, err = gutenbergsearch.NewRedisClient(cfg.cacheRedisAddr, cfg.cacheRedisPassword, cfg.cacheRedisDB,
+			cfg.cacheRedisTimeout)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %s", err)
+		}
+		defer redisClient.Close()
+	}
+
+	caches := prepareCaches(cfg, redisClient)
+	searchService, err := prepareSearchService(cfg, caches)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %s", err)
+	}
 	defer func() {
 		err := searchService.Close()
 		if err != nil {
@@ -168,7 +505,11 @@ func main() {
 	}()
 
 	router := mux.NewRouter()
-	router.Handle("/search", search(searchService))
+	router.Handle("/search", search(searchService, defaultOptions, cfg.searchMaxBookIDs))
+	if cfg.adminToken != "" {
+		registerCacheAdmin(router, caches, cfg.adminToken)
+		registerMetrics(router, cfg.adminToken)
+	}
 
 	srv := &http.Server{
 		Handler:      router,
@@ -189,7 +530,7 @@ func main() {
 
 	<-done
 	log.Print("Closing application...")
-	err := srv.Close()
+	err = srv.Close()
 	if err != nil {
 		log.Printf("Error occurred during close of webserver: %s", err)
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,8 @@ import (
 	"time"
 
 	"fuzzy-search/internal/app/gutenbergsearch"
+	"fuzzy-search/internal/pkg/data"
+	search2 "fuzzy-search/internal/pkg/search"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -18,11 +21,13 @@ type serviceMock struct {
 	errToReturn error
 }
 
-func (s *serviceMock) Search(title, phrase string) (string, error) {
+func (s *serviceMock) Search(query gutenbergsearch.Query) (gutenbergsearch.Answer, error) {
 	if s.errToReturn != nil {
-		return "", s.errToReturn
+		return gutenbergsearch.Answer{}, s.errToReturn
 	}
-	return "", nil
+	book, _ := data.NewBook("Romeo and Juliet", "William Shakespeare", "/ebooks/1513")
+	book.Language = "English"
+	return gutenbergsearch.Answer{Options: query.Options, Book: book}, nil
 }
 func (s *serviceMock) Close() error {
 	return nil
@@ -35,7 +40,7 @@ func (s *serviceMock) setErrToReturn(err error) {
 func testApp() (*httptest.Server, *serviceMock) {
 	r := mux.NewRouter()
 	searchService := &serviceMock{}
-	r.Handle("/search", search(searchService))
+	r.Handle("/search", search(searchService, search2.DefaultOptions(), 3))
 	return httptest.NewServer(r), searchService
 }
 
@@ -75,6 +80,78 @@ func Test_Search(t *testing.T) {
 			description:        "Wrong `phrase` field type",
 			payload:            []byte(`{"title": "some_title", "phrase": true}`),
 			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Search options OK",
+			payload:            []byte(`{"title": "some_title", "phrase": "some_phrase", "max_distance": 1, "min_matched_fraction": 0.5}`),
+			expectedStatusCode: http.StatusOK,
+		}, {
+			description:        "Invalid search option",
+			payload:            []byte(`{"title": "some_title", "phrase": "some_phrase", "min_matched_fraction": 2}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Book filters without title",
+			payload:            []byte(`{"author": "William Shakespeare", "book_language": "en", "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusOK,
+		}, {
+			description:        "Book language without title",
+			payload:            []byte(`{"book_language": "en", "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Empty `author` field",
+			payload:            []byte(`{"title": "some_title", "author": "", "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Wrong `bookshelf` field type",
+			payload:            []byte(`{"bookshelf": "drama", "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Empty ebook ID range",
+			payload:            []byte(`{"title": "romeo", "min_id": 2000, "max_id": 1000, "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Bookshelf with subject",
+			payload:            []byte(`{"bookshelf": 39, "subject": "drama", "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Single book ID",
+			payload:            []byte(`{"book_id": 1513, "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusOK,
+		}, {
+			description:        "List of book IDs",
+			payload:            []byte(`{"book_id": [1513, 2261], "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusOK,
+		}, {
+			description:        "Too many book IDs",
+			payload:            []byte(`{"book_id": [1513, 2261, 1524, 84], "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Duplicate book IDs",
+			payload:            []byte(`{"book_id": [1513, 1513, 1513, 1513], "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusOK,
+		}, {
+			description:        "Empty list of book IDs",
+			payload:            []byte(`{"book_id": [], "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Invalid book ID",
+			payload:            []byte(`{"book_id": [1513, 0], "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Wrong `book_id` field type",
+			payload:            []byte(`{"book_id": "1513", "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Book ID combined with title",
+			payload:            []byte(`{"book_id": 1513, "title": "some_title", "phrase": "some_phrase"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Unsupported language",
+			payload:            []byte(`{"title": "some_title", "phrase": "some_phrase", "language": "xx"}`),
+			expectedStatusCode: http.StatusBadRequest,
+		}, {
+			description:        "Wrong `stop_words` field value",
+			payload:            []byte(`{"title": "some_title", "phrase": "some_phrase", "stop_words": "sometimes"}`),
+			expectedStatusCode: http.StatusBadRequest,
 		},
 	}
 
@@ -109,6 +186,10 @@ func Test_SearchError(t *testing.T) {
 			description:        "Phrase not found",
 			errorReturned:      gutenbergsearch.ErrPhraseNotFound,
 			expectedStatusCode: http.StatusNotFound,
+		}, {
+			description:        "No books found",
+			errorReturned:      gutenbergsearch.ErrNoBooks,
+			expectedStatusCode: http.StatusNotFound,
 		}, {
 			description:        "Processing too long",
 			errorReturned:      gutenbergsearch.ErrTooLong,
@@ -136,3 +217,64 @@ func Test_SearchError(t *testing.T) {
 		})
 	}
 }
+
+func Test_SearchJSONAnswer(t *testing.T) {
+	ts, _ := testApp()
+	defer ts.Close()
+
+	client := http.Client{
+		Timeout: time.Second * 2,
+	}
+
+	payload := `{"title": "some_title", "phrase": "some_phrase", "max_distance": 1, "stop_words": "ignore"}`
+	request, err := http.NewRequest(http.MethodPost, ts.URL+"/search", bytes.NewBuffer([]byte(payload)))
+	assert.Nil(t, err)
+	request.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(request)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var answer AnswerMessage
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&answer))
+
+	expected := Options{
+		MaxDistance:         1,
+		MaxTotalDistance:    -1,
+		MaxRelativeDistance: 0,
+		MinMatchedFraction:  1,
+		StopWords:           "ignore",
+		Language:            "en",
+	}
+	assert.Equal(t, expected, answer.Options)
+
+	expectedBook := Book{
+		ID:       1513,
+		Title:    "Romeo and Juliet",
+		Author:   "William Shakespeare",
+		Language: "English",
+	}
+	assert.Equal(t, expectedBook, answer.Book)
+}
+
+func Test_bookIDsUnmarshal(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected bookIDs
+	}
+
+	testCases := []testCase{
+		{input: `1513`, expected: bookIDs{1513}},
+		{input: `[1513, 2261]`, expected: bookIDs{1513, 2261}},
+		{input: `[2261, 1513, 2261, 1513]`, expected: bookIDs{2261, 1513}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.input), func(t *testing.T) {
+			var ids bookIDs
+			assert.Nil(t, json.Unmarshal([]byte(tc.input), &ids))
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
@@ -3,8 +3,10 @@ module fuzzy-search
 go 1.15
 
 require (
+	github.com/alicebob/miniredis/v2 v2.14.3
 	github.com/gorilla/mux v1.8.0
 	github.com/lithammer/fuzzysearch v1.1.0
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974
 )
@@ -1,8 +1,16 @@
 package gutenbergsearch
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"fuzzy-search/internal/pkg/data"
+	"fuzzy-search/internal/pkg/search"
+
 	"github.com/patrickmn/go-cache"
 )
 
@@ -11,27 +19,244 @@ type Cache interface {
 	Set(key string, value interface{})
 }
 
+// CacheItem describes cached value
+type CacheItem struct {
+	Key     string    `json:"key"`
+	Size    int       `json:"size"`              // estimated size of the value in bytes
+	Expires time.Time `json:"expires,omitempty"` // zero if the item does not expire
+	Pinned  bool      `json:"pinned"`
+}
+
+// CacheStats summarizes usage of a cache since startup
+type CacheStats struct {
+	Items     int   `json:"items"`
+	Bytes     int64 `json:"bytes"` // estimated size of cached values
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"` // items removed because they expired or exceeded memory budget
+}
+
+// AdminCache is a Cache which can be inspected and managed at runtime
+type AdminCache interface {
+	Cache
+	Items() []CacheItem // sorted by key
+	Stats() CacheStats
+	Delete(key string) bool
+	DeletePrefix(prefix string) int
+	Flush() int
+	// Pin keeps the item of given key, also one cached later, from expiring
+	Pin(key string)
+	Unpin(key string)
+}
+
+// sizer is implemented by cached values able to estimate their size in bytes
+type sizer interface {
+	size() int
+}
+
+// sizeOf estimates size of cached value in bytes, values of unknown types are measured by their text form
+func sizeOf(value interface{}) int {
+	switch v := value.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case sizer:
+		return v.size()
+	case data.Book:
+		return bookSize(v)
+	case []data.Book:
+		size := 0
+		for _, book := range v {
+			size += bookSize(book)
+		}
+		return size
+	default:
+		return len(fmt.Sprintf("%v", v))
+	}
+}
+
+func bookSize(book data.Book) int {
+	size := len(book.Title) + len(book.Author) + len(book.Language) + len(book.ReleaseDate) + len(book.CoverURL) +
+		len(book.ID())
+	for _, subject := range book.Subjects {
+		size += len(subject)
+	}
+	for _, format := range book.Formats {
+		size += len(format.Name) + len(format.Type) + len(format.URL)
+	}
+	return size
+}
+
 type memCache struct {
+	hits, misses, removals, deletions int64 // updated atomically
+
 	cache *cache.Cache
+
+	mu     sync.Mutex
+	sizes  map[string]int
+	pinned map[string]bool
+}
+
+func newMemCache(expiration, cleanupInterval time.Duration) *memCache {
+	m := &memCache{
+		cache:  cache.New(expiration, cleanupInterval),
+		sizes:  make(map[string]int),
+		pinned: make(map[string]bool),
+	}
+	m.cache.OnEvicted(m.evicted)
+	return m
+}
+
+// evicted is called by the cache whenever an item is removed, either expired or deleted
+func (m *memCache) evicted(key string, _ interface{}) {
+	atomic.AddInt64(&m.removals, 1)
+	m.mu.Lock()
+	delete(m.sizes, key)
+	m.mu.Unlock()
 }
 
 func (m *memCache) Get(key string) (interface{}, bool) {
-	return m.cache.Get(key)
+	value, ok := m.cache.Get(key)
+	if ok {
+		atomic.AddInt64(&m.hits, 1)
+	} else {
+		atomic.AddInt64(&m.misses, 1)
+	}
+	return value, ok
 }
 
 func (m *memCache) Set(key string, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sizes[key] = sizeOf(value)
+	if m.pinned[key] {
+		m.cache.Set(key, value, cache.NoExpiration)
+		return
+	}
 	m.cache.Set(key, value, cache.DefaultExpiration)
 }
 
+func (m *memCache) Items() []CacheItem {
+	items := m.cache.Items()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]CacheItem, 0, len(items))
+	for key, item := range items {
+		cached := CacheItem{Key: key, Size: m.sizes[key], Pinned: m.pinned[key]}
+		if item.Expiration > 0 {
+			cached.Expires = time.Unix(0, item.Expiration)
+		}
+		list = append(list, cached)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+func (m *memCache) Stats() CacheStats {
+	m.mu.Lock()
+	var bytes int64
+	for _, size := range m.sizes {
+		bytes += int64(size)
+	}
+	m.mu.Unlock()
+
+	return CacheStats{
+		Items:     m.cache.ItemCount(),
+		Bytes:     bytes,
+		Hits:      atomic.LoadInt64(&m.hits),
+		Misses:    atomic.LoadInt64(&m.misses),
+		Evictions: atomic.LoadInt64(&m.removals) - atomic.LoadInt64(&m.deletions),
+	}
+}
+
+func (m *memCache) Delete(key string) bool {
+	if _, ok := m.cache.Get(key); !ok {
+		return false
+	}
+	// counted before the item is removed, so the removal is not taken for an eviction
+	atomic.AddInt64(&m.deletions, 1)
+	m.cache.Delete(key)
+	return true
+}
+
+func (m *memCache) DeletePrefix(prefix string) int {
+	deleted := 0
+	for key := range m.cache.Items() {
+		if strings.HasPrefix(key, prefix) && m.Delete(key) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (m *memCache) Flush() int {
+	return m.DeletePrefix("")
+}
+
+func (m *memCache) Pin(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pinned[key] = true
+	if value, ok := m.cache.Get(key); ok {
+		m.cache.Set(key, value, cache.NoExpiration)
+	}
+}
+
+func (m *memCache) Unpin(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pinned, key)
+	if value, ok := m.cache.Get(key); ok {
+		m.cache.Set(key, value, cache.DefaultExpiration)
+	}
+}
+
 type dummyCache struct{}
 
 func (d dummyCache) Get(key string) (interface{}, bool) { return nil, false }
 func (d dummyCache) Set(key string, value interface{})  {}
+func (d dummyCache) Items() []CacheItem                 { return []CacheItem{} }
+func (d dummyCache) Stats() CacheStats                  { return CacheStats{} }
+func (d dummyCache) Delete(key string) bool             { return false }
+func (d dummyCache) DeletePrefix(prefix string) int     { return 0 }
+func (d dummyCache) Flush() int                         { return 0 }
+func (d dummyCache) Pin(key string)                     {}
+func (d dummyCache) Unpin(key string)                   {}
 
-func NewCache(enabled bool, expiration, cleanupInterval time.Duration) Cache {
+// NewCache returns in-memory cache, all its methods are no-op if it is disabled. Cache with maxBytes budget evicts
+// the least recently used items once estimated size of cached values exceeds it, 0 disables the budget.
+func NewCache(enabled bool, expiration, cleanupInterval time.Duration, maxBytes int64) AdminCache {
 	if !enabled {
 		return &dummyCache{}
 	}
+	if maxBytes > 0 {
+		return newLRUCache(maxBytes, expiration, cleanupInterval)
+	}
+
+	return newMemCache(expiration, cleanupInterval)
+}
+
+type indexStore struct {
+	cache Cache
+}
+
+func (i *indexStore) Get(key string) ([]byte, bool) {
+	value, ok := i.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	raw, ok := value.([]byte)
+	return raw, ok
+}
+
+func (i *indexStore) Set(key string, value []byte) {
+	i.cache.Set(key, value)
+}
 
-	return &memCache{cache.New(expiration, cleanupInterval)}
+// NewIndexStore allows to keep search indexes in given cache, it should not be shared with other values so that
+// indexes do not take their budget
+func NewIndexStore(cache Cache) search.IndexStore {
+	return &indexStore{cache}
 }
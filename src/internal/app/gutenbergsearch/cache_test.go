@@ -0,0 +1,26 @@
+package gutenbergsearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemCacheEvictions(t *testing.T) {
+	c := NewCache(true, time.Millisecond*10, time.Millisecond*5, 0)
+	c.Set("/ebooks/1513", cachedContent{content: "Romeo and Juliet"})
+	c.Set("/ebooks/1524", "Hamlet")
+	c.Pin("/ebooks/84")
+	c.Set("/ebooks/84", "Frankenstein")
+	assert.Equal(t, int64(34), c.Stats().Bytes)
+
+	// deleted items are not evictions
+	assert.True(t, c.Delete("/ebooks/1524"))
+	assert.False(t, c.Delete("/ebooks/1524"))
+
+	time.Sleep(time.Millisecond * 50)
+	_, ok := c.Get("/ebooks/84")
+	assert.True(t, ok)
+	assert.Equal(t, CacheStats{Items: 1, Bytes: 12, Hits: 1, Evictions: 1}, c.Stats())
+}
@@ -0,0 +1,154 @@
+package gutenbergsearch
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+)
+
+// cachedContent is downloaded book text kept in content cache, together with validators allowing to revalidate it
+// cheaply once it gets stale
+type cachedContent struct {
+	content    string
+	validators data.Validators
+	fetched    time.Time
+}
+
+func (c cachedContent) size() int {
+	return len(c.content) + len(c.validators.ETag) + len(c.validators.LastModified)
+}
+
+// fresh tells whether content can be used without revalidation, maxAge lower or equal to 0 disables revalidation
+func (c cachedContent) fresh(maxAge time.Duration, now time.Time) bool {
+	return maxAge <= 0 || now.Sub(c.fetched) < maxAge
+}
+
+// downloadRequest is a book to download, stale content is revalidated instead of downloaded in full if possible
+type downloadRequest struct {
+	book  data.Book
+	stale *cachedContent
+}
+
+// download fetches content of requested book. Stale content is revalidated with conditional request if data
+// provider supports it, so unchanged books are not downloaded again.
+func (s *searcher) download(request downloadRequest) (cachedContent, error) {
+	revalidator, ok := s.dataProvider.(data.Revalidator)
+	if !ok {
+		content, err := s.dataProvider.DownloadBook(request.book)
+		return cachedContent{content: content, fetched: time.Now()}, err
+	}
+
+	var validators data.Validators
+	if request.stale != nil {
+		validators = request.stale.validators
+	}
+	content, validators, err := revalidator.DownloadBookIfModified(request.book, validators)
+	if errors.Is(err, data.ErrNotModified) && request.stale != nil {
+		revalidated := *request.stale
+		revalidated.fetched = time.Now()
+		return revalidated, nil
+	}
+	return cachedContent{content: content, validators: validators, fetched: time.Now()}, err
+}
+
+// downloadResult is an outcome of a single download attempt run by the download pool
+type downloadResult struct {
+	content cachedContent
+	err     error
+}
+
+// attemptTask returns pool task of a single download attempt of requested book
+func (s *searcher) attemptTask(request downloadRequest, priority downloadPriority, result *downloadResult) *poolTask {
+	return newPoolTask(priority, func() {
+		result.content, result.err = s.download(request)
+	})
+}
+
+// downloadShared starts download of requested book on the download pool with given priority, concurrent requests
+// of the same book share a single download. Download still queued is raised to the highest priority requested.
+func (s *searcher) downloadShared(request downloadRequest, priority downloadPriority) *flightCall {
+	id := request.book.ID()
+	s.downloadTasksMu.Lock()
+	defer s.downloadTasksMu.Unlock()
+
+	var result downloadResult
+	task := s.attemptTask(request, priority, &result)
+	call, started := s.downloads.start(id, func() (interface{}, error) {
+		content, err := s.fetchBook(request, task, &result)
+		s.downloadTasksMu.Lock()
+		delete(s.downloadTasks, id)
+		s.downloadTasksMu.Unlock()
+		return content, err
+	})
+
+	if !started {
+		if shared, ok := s.downloadTasks[id]; ok {
+			s.downloadPool.raise(shared, priority)
+		}
+		return call
+	}
+	if s.downloadTasks == nil {
+		s.downloadTasks = make(map[string]*poolTask)
+	}
+	s.downloadTasks[id] = task
+	return call
+}
+
+// retryTask replaces finished attempt of requested book with the next one, which keeps priority of the previous
+// attempt including a raise by searches which joined the download meanwhile
+func (s *searcher) retryTask(request downloadRequest, previous *poolTask, result *downloadResult) *poolTask {
+	s.downloadTasksMu.Lock()
+	defer s.downloadTasksMu.Unlock()
+	task := s.attemptTask(request, s.downloadPool.priorityOf(previous), result)
+	if s.downloadTasks != nil {
+		s.downloadTasks[request.book.ID()] = task
+	}
+	return task
+}
+
+// fetchBook runs download attempts of requested book on the download pool and caches its content. Books without
+// text are cached with empty content, stale content is used when it cannot be revalidated. Pool worker is released
+// while waiting for a retry, so throttled books do not block downloads of other ones.
+func (s *searcher) fetchBook(request downloadRequest, task *poolTask, result *downloadResult) (cachedContent, error) {
+	book := request.book
+	for attempt := 1; ; attempt++ {
+		// requests are spaced in time by the rate limit of data provider
+		if err := s.downloadPool.runTask(task); err != nil {
+			return cachedContent{}, err
+		}
+		content, err := result.content, result.err
+		if errors.Is(err, data.ErrTxtLinkRefNotAvailable) {
+			// this book position apparently does not include text version
+			log.Printf("[DWorker] Text book not available (\"%s\" - %s [%s]): %s", book.Title, book.Author, book.ID(), err)
+			// preparing an empty content as successful download for caching purpose
+			content, err = cachedContent{fetched: time.Now()}, nil
+		}
+		if err == nil {
+			s.contentCache.Set(book.ID(), content)
+			return content, nil
+		}
+
+		delay, retry := s.retryPolicy.backoff(attempt, err)
+		if !retry && request.stale != nil {
+			log.Printf("[DWorker] Revalidation failed after %d attempt(s), using stale content: %s", attempt, err)
+			s.contentCache.Set(book.ID(), *request.stale)
+			return *request.stale, nil
+		}
+		if !retry {
+			log.Printf("[DWorker] Download failed after %d attempt(s) (permanent: %t): %s",
+				attempt, data.IsPermanent(err), err)
+			return cachedContent{}, err
+		}
+		log.Printf("[DWorker] Download error: %s (attempt %d/%d, retrying in %s)",
+			err, attempt, s.retryPolicy.Attempts, delay)
+
+		select {
+		case <-s.exit:
+			return cachedContent{}, err
+		case <-time.After(delay):
+		}
+		task = s.retryTask(request, task, result)
+	}
+}
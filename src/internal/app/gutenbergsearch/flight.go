@@ -0,0 +1,54 @@
+package gutenbergsearch
+
+import (
+	"sync"
+)
+
+// flightCall is an operation in progress, its result is shared by all callers of the same key
+type flightCall struct {
+	done   chan struct{}
+	val    interface{}
+	err    error
+	shared bool
+}
+
+// flightGroup coalesces concurrent operations of the same key, so eg. a book requested by several searches at once
+// is downloaded only once
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// start returns call of given key, fn is started in a new goroutine unless the call is already in progress, started
+// tells whether fn was started
+func (g *flightGroup) start(key string, fn func() (interface{}, error)) (call *flightCall, started bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		call.shared = true
+		return call, false
+	}
+
+	call = &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	go func() {
+		call.val, call.err = fn()
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	return call, true
+}
+
+// do executes fn unless operation of given key is already in progress and waits for the result, shared tells
+// whether the result was delivered to more callers
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (val interface{}, err error, shared bool) {
+	call, _ := g.start(key, fn)
+	<-call.done
+	// call is removed from the group before it is done, so shared flag is not changed anymore
+	return call.val, call.err, call.shared
+}
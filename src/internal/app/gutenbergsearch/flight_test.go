@@ -0,0 +1,56 @@
+package gutenbergsearch
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlightGroupDo(t *testing.T) {
+	var group flightGroup
+	var calls int32
+	release := make(chan struct{})
+
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "Romeo and Juliet", nil
+	}
+
+	const callers = 5
+	results := make(chan interface{}, callers)
+	var started, finished sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		started.Add(1)
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			call, _ := group.start("/ebooks/1513", fn)
+			started.Done()
+			<-call.done
+			assert.True(t, call.shared)
+			results <- call.val
+		}()
+	}
+	started.Wait()
+	close(release)
+	finished.Wait()
+	close(results)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for result := range results {
+		assert.Equal(t, "Romeo and Juliet", result)
+	}
+
+	// finished call is not reused
+	val, err, shared := group.do("/ebooks/1513", func() (interface{}, error) {
+		return nil, errors.New("not found")
+	})
+	assert.Nil(t, val)
+	assert.EqualError(t, err, "not found")
+	assert.False(t, shared)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
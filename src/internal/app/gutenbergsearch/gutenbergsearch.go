@@ -17,26 +17,56 @@ import (
 
 var (
 	ErrPhraseNotFound = errors.New("phrase not found")
+	ErrNoBooks        = errors.New("no books available for this query")
 	ErrTooLong        = errors.New("request took too long")
 )
 
 type downloadJobs struct {
 	ctx           context2.Context
-	downloadQueue <-chan data.Book
+	downloadQueue <-chan downloadRequest
 	outputQueue   chan<- book
+	failures      *downloadFailures
+	priority      downloadPriority
+}
+
+// downloadFailures collects failures of a download job worth reporting when phrase is not found
+type downloadFailures struct {
+	mu         sync.Mutex
+	disallowed error // first download refused by crawl policy
+}
+
+func (f *downloadFailures) add(err error) {
+	var disallowed *data.DisallowedError
+	if !errors.As(err, &disallowed) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.disallowed == nil {
+		f.disallowed = err
+	}
+}
+
+func (f *downloadFailures) err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.disallowed
 }
 
 type searchJobs struct {
 	ctx         context2.Context
 	phrase      string
+	options     search.Options
 	searchQueue <-chan book
 	outputQueue chan<- result
+	failures    *downloadFailures // of books streamed by search workers
 }
 
 type book struct {
 	title, author string
 	uniqueID      string
 	content       string
+	meta          data.Book
 }
 
 type result struct {
@@ -44,14 +74,23 @@ type result struct {
 	result string
 }
 
-type Searcher interface {
-	Search(title, phrase string) (string, error)
-	io.Closer
+// Query describes single search request
+type Query struct {
+	Books   data.BookQuery // criteria of books to search in
+	Phrase  string
+	Options search.Options // thresholds used to accept phrase occurrence
 }
 
-func randomDurationRange(a, b time.Duration) time.Duration {
-	rawI := rand.Intn(int(b - a))
-	return time.Duration(int(a) + rawI)
+// Answer is a phrase occurrence found for Query
+type Answer struct {
+	Result  string         // phrase occurrence with its context
+	Options search.Options // thresholds used to accept phrase occurrence
+	Book    data.Book      // book in which the phrase was found
+}
+
+type Searcher interface {
+	Search(query Query) (Answer, error)
+	io.Closer
 }
 
 // twoPartCacheKey generate unique key for cache usage
@@ -60,14 +99,33 @@ func twoPartCacheKey(a, b string) string {
 	return a + "/" + b
 }
 
+// answerCacheKey generate unique key of answer for given query
+func answerCacheKey(query Query) string {
+	return twoPartCacheKey(query.Books.Key(), query.Phrase) + "/" + query.Options.Key()
+}
+
 type searcher struct {
-	answerCache, listingCache, contentCache Cache
+	answerCache  answerStore
+	listingCache listingStore
+	detailsCache detailsStore // kept in listing cache
+	contentCache contentStore
 
 	dataProvider        data.Provider
 	contextProvider     context.Provider
 	searchEngine        search.Searcher
-	downloadDelay       [2]time.Duration // min, max
-	searchEngineWorkers int              // per request
+	searchEngineWorkers int // per request
+	retryPolicy         RetryPolicy
+	contentMaxAge       time.Duration // cached content older than that is revalidated
+	streamBooks         bool          // books are streamed into search engine instead of being downloaded
+
+	// in-flight listings and downloads shared by concurrent searches, keyed by query and book ID
+	listings, downloads flightGroup
+	downloadPool        *downloadPool
+	downloadTasksMu     sync.Mutex
+	downloadTasks       map[string]*poolTask // pool tasks of in-flight downloads by book ID
+
+	warmup  WarmupConfig
+	queries queryStats // book queries of searches, the most frequent ones are warmed
 
 	tasksWg      sync.WaitGroup
 	exit         chan bool
@@ -83,33 +141,44 @@ func NewSearcher(
 	dataProvider data.Provider,
 	contextProvider context.Provider,
 	searchEngine search.Searcher,
-	downloadDelay [2]time.Duration, // min/max
-
+	downloadWorkers int, // shared by all searches
+	retryPolicy RetryPolicy,
+	contentMaxAge time.Duration, // 0 disables revalidation
+	warmup WarmupConfig,
 ) Searcher {
 	rand.Seed(time.Now().UnixNano())
 
 	s := &searcher{
-		answerCache:  answerCache,
-		listingCache: listingCache,
-		contentCache: contentCache,
+		answerCache:  newAnswerStore(answerCache),
+		listingCache: newListingStore(listingCache),
+		detailsCache: newDetailsStore(listingCache),
+		contentCache: newContentStore(contentCache),
 
 		dataProvider:        dataProvider,
 		contextProvider:     contextProvider,
 		searchEngine:        searchEngine,
-		downloadDelay:       downloadDelay,
 		searchEngineWorkers: searchWorkers,
+		retryPolicy:         retryPolicy,
+		contentMaxAge:       contentMaxAge,
+		downloadPool:        newDownloadPool(downloadWorkers),
+		streamBooks:         streams(contentCache, dataProvider, searchEngine),
+		warmup:              warmup,
 
 		tasksWg:      sync.WaitGroup{},
 		exit:         make(chan bool, 1),
 		downloadJobs: make(chan downloadJobs, 5),
 		searchJobs:   make(chan searchJobs, searchWorkers),
 	}
+	if s.streamBooks {
+		log.Print("Content cache is disabled, books are streamed into search engine")
+	}
 	s.StartBackgroundTasks()
 	return s
 }
 
 func (s *searcher) Close() error {
 	close(s.exit)
+	s.downloadPool.close()
 	s.tasksWg.Wait()
 	return nil
 }
@@ -119,42 +188,87 @@ func (s *searcher) StartBackgroundTasks() {
 	s.tasksWg.Add(1)
 	go s.searchTask()
 	s.tasksWg.Add(1)
+	if s.warmup.enabled() {
+		s.tasksWg.Add(1)
+		go s.warmTask()
+	}
 }
 
-func (s *searcher) getBookPositions(title string) ([]data.Book, error) {
-	cachedBookPositions, ok := s.listingCache.Get(title)
+func (s *searcher) getBookPositions(query data.BookQuery) ([]data.Book, error) {
+	if len(query.IDs) > 0 {
+		// books requested directly, there is no need to read the listing
+		return query.Books()
+	}
+
+	bookPositions, ok := s.listingCache.Get(query.Key())
 	if ok {
-		bookPositions := cachedBookPositions.([]data.Book)
 		log.Printf("Read %d book positions from cache", len(bookPositions))
 		return bookPositions, nil
 	}
 
-	bookPositions, err := s.dataProvider.GetBooks(title)
+	listed, err, shared := s.listings.do(query.Key(), func() (interface{}, error) {
+		bookPositions, err := s.dataProvider.GetBooks(query)
+		var partial *data.PartialError
+		if errors.As(err, &partial) {
+			// listing is used, but it is not cached so missing books are listed by the next search
+			log.Printf("Read %d book positions from external source, not caching them: %s", len(bookPositions), err)
+			return bookPositions, nil
+		}
+		if err != nil {
+			return bookPositions, err
+		}
+		log.Printf("Read %d book positions from external source", len(bookPositions))
+		s.listingCache.Set(query.Key(), bookPositions)
+		return bookPositions, nil
+	})
+	if shared {
+		log.Printf("Listing of %s shared with concurrent searches", query)
+	}
+	bookPositions = listed.([]data.Book)
 	if err != nil {
 		return bookPositions, fmt.Errorf("downloading book positions failed: %w", err)
 	}
-	log.Printf("Read %d book positions from external source", len(bookPositions))
-	s.listingCache.Set(title, bookPositions)
 	return bookPositions, nil
 }
 
-func (s *searcher) Search(title, phrase string) (string, error) {
-	var exit bool
+// bookDetails supplements listing metadata of the book with details from the book page, details are optional
+// so failure is not fatal
+func (s *searcher) bookDetails(book data.Book) data.Book {
+	key := "details/" + book.ID()
+	cachedDetails, ok := s.detailsCache.Get(key)
+	if ok {
+		return cachedDetails
+	}
 
-	cachedAnswer, ok := s.answerCache.Get(twoPartCacheKey(title, phrase))
+	detailed, err := s.dataProvider.BookDetails(book)
+	if err != nil {
+		log.Printf("Reading book details failed (\"%s\" - %s [%s]): %s", book.Title, book.Author, book.ID(), err)
+		return book
+	}
+	s.detailsCache.Set(key, detailed)
+	return detailed
+}
+
+func (s *searcher) Search(query Query) (Answer, error) {
+	phrase := query.Phrase
+
+	cachedAnswer, ok := s.answerCache.Get(answerCacheKey(query))
 	if ok {
 		log.Println("found cached query result")
-		return cachedAnswer.(string), nil
+		return cachedAnswer, nil
 	}
 
-	log.Printf("Searching books with \"%s\" title", title)
-	bookPositions, err := s.getBookPositions(title)
+	log.Printf("Searching books with %s", query.Books)
+	if s.warmup.TopQueries > 0 && !query.Books.Empty() {
+		s.queries.record(query.Books)
+	}
+	bookPositions, err := s.getBookPositions(query.Books)
 	if err != nil {
-		return "", fmt.Errorf("getBookPositions failed: %w", err)
+		return Answer{}, fmt.Errorf("getBookPositions failed: %w", err)
 	}
 
 	if len(bookPositions) < 1 {
-		return "", fmt.Errorf("no books available for this title")
+		return Answer{}, ErrNoBooks
 	}
 
 	var booksToAnalyze = make(chan book, 25)
@@ -163,39 +277,44 @@ func (s *searcher) Search(title, phrase string) (string, error) {
 	var resultChan = make(chan result, 1)
 	// searchTask will close this channel
 
-	var booksProcessedFromCache = make(map[string]bool) // key: book unique ID
+	var cachedBooks []book                             // fresh cached books, searched before downloads
+	var staleContent = make(map[string]*cachedContent) // key: book unique ID
+	var booksToDownload []data.Book
 
-	// Gather all currently cached books
+	// Gather all currently cached books, stale ones are revalidated by downloadTask
 	for _, bookPosition := range bookPositions {
-		cachedBook, ok := s.contentCache.Get(bookPosition.ID())
+		cached, ok := s.contentCache.Get(bookPosition.ID())
+		if ok && !cached.fresh(s.contentMaxAge, time.Now()) {
+			staleContent[bookPosition.ID()] = &cached
+			ok = false
+		}
 		if !ok {
+			booksToDownload = append(booksToDownload, bookPosition)
 			continue
 		}
 
-		booksProcessedFromCache[bookPosition.ID()] = true
 		log.Printf("Load book from cache (\"%s\" - %s)", bookPosition.Title, bookPosition.Author)
-		bookContent := cachedBook.(string)
-
-		if exit {
-			break
-		}
-		booksToAnalyze <- book{
+		cachedBooks = append(cachedBooks, book{
 			title:    bookPosition.Title,
 			author:   bookPosition.Author,
 			uniqueID: bookPosition.ID(),
-			content:  bookContent,
-		}
+			content:  cached.content,
+			meta:     bookPosition,
+		})
 	}
 
-	downloadQueue := make(chan data.Book, 25)
+	downloadQueue := make(chan downloadRequest, 25)
 
 	downloadCtx, downloadCancel := context2.WithCancel(context2.Background())
 	defer downloadCancel()
 
+	failures := &downloadFailures{}
 	s.downloadJobs <- downloadJobs{
 		ctx:           downloadCtx,
 		downloadQueue: downloadQueue,
 		outputQueue:   booksToAnalyze,
+		failures:      failures,
+		priority:      priorityInteractive,
 	}
 
 	searchCtx, searchCancel := context2.WithCancel(context2.Background())
@@ -204,19 +323,31 @@ func (s *searcher) Search(title, phrase string) (string, error) {
 	s.searchJobs <- searchJobs{
 		ctx:         searchCtx,
 		phrase:      phrase,
+		options:     query.Options,
 		searchQueue: booksToAnalyze,
 		outputQueue: resultChan,
+		failures:    failures,
 	}
 
-	// Queue up missing books to download
+	// Feed cached books and queue up missing books to download, booksToAnalyze is closed by downloadTask once
+	// downloadQueue is closed so cached books have to be pushed first
 	go func() {
+		defer close(downloadQueue)
+		for _, cachedBook := range cachedBooks {
+			select {
+			case <-downloadCtx.Done():
+				return
+			case booksToAnalyze <- cachedBook:
+			}
+		}
+
 		var scheduled int
-		for _, bookPosition := range bookPositions {
-			_, ok := booksProcessedFromCache[bookPosition.ID()]
-			if ok {
-				continue
+		for _, bookPosition := range booksToDownload {
+			select {
+			case <-downloadCtx.Done():
+				return
+			case downloadQueue <- downloadRequest{book: bookPosition, stale: staleContent[bookPosition.ID()]}:
 			}
-			downloadQueue <- bookPosition
 			scheduled += 1
 		}
 		log.Printf("Scheduled %d books to download", scheduled)
@@ -225,15 +356,23 @@ func (s *searcher) Search(title, phrase string) (string, error) {
 	select {
 	case result, ok := <-resultChan:
 		if ok {
-			s.answerCache.Set(twoPartCacheKey(title, phrase), result.result)
 			log.Printf("result found! ('%s' - %s)", result.book.title, result.book.author)
-			return result.result, nil
+			answer := Answer{
+				Result:  result.result,
+				Options: query.Options,
+				Book:    s.bookDetails(result.book.meta),
+			}
+			s.answerCache.Set(answerCacheKey(query), answer)
+			return answer, nil
 		}
 		// processing ended but no result pushed on channel
-		return "", ErrPhraseNotFound
+		if err := failures.err(); err != nil {
+			return Answer{}, fmt.Errorf("phrase not found, some books could not be downloaded: %w", err)
+		}
+		return Answer{}, ErrPhraseNotFound
 	case <-time.After(time.Second * 120):
 		// processing took too long
-		return "", ErrTooLong
+		return Answer{}, ErrTooLong
 	}
 }
 
@@ -251,7 +390,8 @@ root:
 				defer close(job.outputQueue)
 				startTime := time.Now()
 			main:
-				for bookToDownload := range job.downloadQueue {
+				for request := range job.downloadQueue {
+					bookToDownload := request.book
 					select {
 					case <-job.ctx.Done():
 						log.Printf("[DWorker] Downloading interrupted")
@@ -259,44 +399,38 @@ root:
 					case <-time.After(time.Millisecond * 10):
 					}
 
-					var content string
-					var err error
-					var failedTries int
-
-					downloadTries := 3
-
-				try:
-					for i := 0; i < downloadTries; i++ {
-
-						sleepTime := randomDurationRange(s.downloadDelay[0], s.downloadDelay[1])
-						log.Printf("[DWorker] sleeping for %s", sleepTime)
-						time.Sleep(sleepTime)
-
-						content, err = s.dataProvider.DownloadBook(bookToDownload)
-						if err != nil {
-							if errors.Is(err, data.ErrTxtLinkRefNotAvailable) {
-								// this book position apparently does not include text version
-								log.Printf(
-									"[DWorker] Text book not available (\"%s\" - %s [%s]): %s",
-									bookToDownload.Title, bookToDownload.Author, bookToDownload.ID(),
-									err,
-								)
-								// preparing an empty content as successful download for caching purpose
-								content = ""
-								break try
-							}
-
-							log.Printf("[DWorker] Download error: %s (try %d/%d)", err, i+1, downloadTries)
-							failedTries += 1
-							continue try
+					if s.streamBooks {
+						// book is opened by search worker, its text is never loaded as a whole
+						select {
+						case <-job.ctx.Done():
+							log.Printf("[DWorker] Downloading interrupted")
+							return
+						case job.outputQueue <- book{
+							title:    bookToDownload.Title,
+							author:   bookToDownload.Author,
+							uniqueID: bookToDownload.ID(),
+							meta:     bookToDownload,
+						}:
 						}
-						// successful download
-						break try
+						continue main
+					}
+
+					// concurrent searches share download of the same book
+					call := s.downloadShared(request, job.priority)
+					select {
+					case <-job.ctx.Done():
+						log.Printf("[DWorker] Downloading interrupted")
+						return
+					case <-call.done:
 					}
-					if failedTries == downloadTries {
-						log.Print("[DWorker] Download failed: retries exceeded")
+					if call.err != nil {
+						job.failures.add(call.err)
 						continue main
 					}
+					if call.shared {
+						log.Printf("[DWorker] Download of %s shared with concurrent searches", bookToDownload.ID())
+					}
+					content := call.val.(cachedContent)
 
 					endTime := time.Now()
 
@@ -304,7 +438,8 @@ root:
 						title:    bookToDownload.Title,
 						author:   bookToDownload.Author,
 						uniqueID: bookToDownload.ID(),
-						content:  content,
+						content:  content.content,
+						meta:     bookToDownload,
 					}
 
 					log.Printf("[DWorker] Book ('%s' - %s) downloaded in %s",
@@ -313,8 +448,6 @@ root:
 						endTime.Sub(startTime),
 					)
 
-					s.contentCache.Set(bookToDownload.ID(), content)
-
 					select {
 					case <-job.ctx.Done():
 						log.Printf("[DWorker] Downloading interrupted")
@@ -359,19 +492,18 @@ root:
 							case <-time.After(time.Millisecond * 10):
 							}
 
-							searchResult, err := s.searchEngine.Search(book.content, job.phrase)
+							searchResult, text, err := s.searchBook(book, job.phrase, job.options, job.failures)
 							if err != nil {
 								log.Printf("[SWorker %d] no result for book (\"%s\" - %s [%s]): %s", workerID, book.title, book.author, book.uniqueID, err)
-								return
+								continue
 							}
 
-							withContext, err := s.contextProvider.ProvideContext(book.content, searchResult.PosS, searchResult.PosE)
+							withContext, err := s.contextProvider.ProvideContext(text, searchResult.PosS, searchResult.PosE)
 							if err != nil {
 								log.Printf("[SWorker %d] failed to provide context for \"%s\" match: %s", workerID, searchResult.Phrase, err)
-								return
+								continue
 							}
 
-							s.answerCache.Set(twoPartCacheKey(book.title, job.phrase), withContext)
 							r := result{
 								book:   book,
 								result: withContext,
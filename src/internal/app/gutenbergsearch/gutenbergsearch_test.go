@@ -0,0 +1,169 @@
+package gutenbergsearch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"fuzzy-search/internal/pkg/context"
+	"fuzzy-search/internal/pkg/data"
+	"fuzzy-search/internal/pkg/search"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchCachedBooks(t *testing.T) {
+	var ids []int
+	contentCache := NewCache(true, time.Hour, time.Hour, 0)
+	contents := newContentStore(contentCache)
+	for id := 1; id <= 30; id++ {
+		ids = append(ids, id)
+		content := "Lorem ipsum dolor sit amet, consectetur adipiscing elit."
+		if id == 30 {
+			content = "Two households, both alike in dignity, in fair Verona, where we lay our scene.\n\n"
+		}
+		contents.Set(fmt.Sprintf("/ebooks/%d", id), cachedContent{content: content, fetched: time.Now()})
+	}
+
+	provider := &popularProviderMock{}
+	s := NewSearcher(
+		2,
+		NewCache(false, 0, 0, 0),
+		NewCache(true, time.Hour, time.Hour, 0),
+		contentCache,
+		provider,
+		context.NewProvider(),
+		search.NewSearcher(false),
+		1,
+		RetryPolicy{Attempts: 1},
+		time.Hour,
+		WarmupConfig{},
+	)
+	defer s.Close()
+
+	type testCase struct {
+		phrase   string
+		expected error
+	}
+
+	testCases := []testCase{
+		{phrase: "in fair Verona", expected: nil},
+		{phrase: "wherefore art thou", expected: ErrPhraseNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.phrase), func(t *testing.T) {
+			done := make(chan error, 1)
+			go func() {
+				answer, err := s.Search(Query{
+					Books:   data.BookQuery{IDs: ids},
+					Phrase:  tc.phrase,
+					Options: search.DefaultOptions(),
+				})
+				if err == nil {
+					assert.Equal(t, "/ebooks/30", answer.Book.ID())
+				}
+				done <- err
+			}()
+
+			select {
+			case err := <-done:
+				assert.Equal(t, tc.expected, err)
+			case <-time.After(time.Second * 5):
+				t.Fatal("search did not finish")
+			}
+		})
+	}
+	// all books were cached
+	assert.Empty(t, provider.downloads)
+	// queries are not counted unless they are warmed
+	assert.Empty(t, s.(*searcher).queries.counts)
+}
+
+// partialProviderMock lists books together with given listing error
+type partialProviderMock struct {
+	popularProviderMock
+	listingErr error
+}
+
+func (p *partialProviderMock) GetBooks(query data.BookQuery) ([]data.Book, error) {
+	return mockBooks(p.listed), p.listingErr
+}
+
+func TestGetBookPositionsPartial(t *testing.T) {
+	provider := &partialProviderMock{
+		popularProviderMock: popularProviderMock{listed: []int{1513, 1524}},
+		listingErr:          &data.PartialError{Err: errors.New("gutenberg offline")},
+	}
+	s := &searcher{
+		listingCache: newListingStore(NewCache(true, time.Hour, time.Hour, 0)),
+		dataProvider: provider,
+	}
+	query := data.BookQuery{Author: "shakespeare"}
+
+	books, err := s.getBookPositions(query)
+	assert.Nil(t, err)
+	assert.Len(t, books, 2)
+	_, ok := s.listingCache.Get(query.Key())
+	assert.False(t, ok)
+
+	provider.listingErr = nil
+	_, err = s.getBookPositions(query)
+	assert.Nil(t, err)
+	_, ok = s.listingCache.Get(query.Key())
+	assert.True(t, ok)
+}
+
+// openerProviderMock streams the same text for every book and counts opened books
+type openerProviderMock struct {
+	popularProviderMock
+	opens []string
+}
+
+func (p *openerProviderMock) OpenBook(book data.Book) (io.ReadCloser, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opens = append(p.opens, book.ID())
+	if book.ID() != "/ebooks/3" {
+		return ioutil.NopCloser(strings.NewReader("Lorem ipsum dolor sit amet.")), nil
+	}
+	content := strings.Repeat("Lorem ipsum dolor sit amet. ", 1000) +
+		"Two households, both alike in dignity, in fair Verona, where we lay our scene.\n\n" +
+		strings.Repeat("Lorem ipsum dolor sit amet. ", 1000)
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func TestSearchStreamedBooks(t *testing.T) {
+	provider := &openerProviderMock{popularProviderMock: popularProviderMock{listed: []int{1, 2, 3}}}
+	s := NewSearcher(
+		2,
+		NewCache(false, 0, 0, 0),
+		NewCache(true, time.Hour, time.Hour, 0),
+		NewCache(false, 0, 0, 0),
+		provider,
+		context.NewProvider(),
+		search.NewStreamSearcher(false, 64),
+		1,
+		RetryPolicy{Attempts: 1},
+		0,
+		WarmupConfig{},
+	)
+	defer s.Close()
+	assert.True(t, s.(*searcher).streamBooks)
+
+	answer, err := s.Search(Query{
+		Books:   data.BookQuery{Author: "shakespeare"},
+		Phrase:  "in fair Verona",
+		Options: search.DefaultOptions(),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "/ebooks/3", answer.Book.ID())
+	assert.Equal(t, "in fair Verona, where we lay our scene.", answer.Result)
+	// books were streamed, none of them was downloaded as a whole
+	assert.Empty(t, provider.downloads)
+	assert.Contains(t, provider.opens, "/ebooks/3")
+}
@@ -0,0 +1,235 @@
+package gutenbergsearch
+
+import (
+	"container/list"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	size    int       // estimated size of the value and the key in bytes
+	expires time.Time // zero if the entry does not expire
+}
+
+// lruCache keeps total estimated size of cached values within a byte budget, the least recently used entries are
+// evicted first. Pinned entries are neither evicted nor expired. Like go-cache, it wraps the entries so that the
+// janitor removing expired entries does not keep the cache alive, the janitor is stopped once it is collected.
+type lruCache struct {
+	*lru
+}
+
+type lru struct {
+	mu         sync.Mutex
+	maxBytes   int64
+	expiration time.Duration // 0 disables expiration
+	bytes      int64
+	entries    map[string]*list.Element
+	order      *list.List // most recently used at front
+	pinned     map[string]bool
+
+	hits, misses, evictions int64
+}
+
+// newLRUCache returns cache of given byte budget, expired entries are removed every cleanupInterval
+func newLRUCache(maxBytes int64, expiration, cleanupInterval time.Duration) *lruCache {
+	c := &lruCache{&lru{
+		maxBytes:   maxBytes,
+		expiration: expiration,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		pinned:     make(map[string]bool),
+	}}
+	if expiration > 0 && cleanupInterval > 0 {
+		stop := make(chan bool)
+		go c.lru.janitor(cleanupInterval, stop)
+		runtime.SetFinalizer(c, func(*lruCache) { close(stop) })
+	}
+	return c
+}
+
+// janitor removes expired entries every interval until stopped, so they do not take the budget until evicted
+func (c *lru) janitor(interval time.Duration, stop chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			c.removeExpired(time.Now())
+			c.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *lru) expired(entry *lruEntry, now time.Time) bool {
+	return !entry.expires.IsZero() && now.After(entry.expires)
+}
+
+func (c *lru) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*lruEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(entry.size)
+}
+
+// removeExpired drops all expired entries
+func (c *lru) removeExpired(now time.Time) {
+	for _, element := range c.entries {
+		if c.expired(element.Value.(*lruEntry), now) {
+			c.remove(element)
+			c.evictions++
+		}
+	}
+}
+
+func (c *lru) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok && c.expired(element.Value.(*lruEntry), time.Now()) {
+		c.remove(element)
+		c.evictions++
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).value, true
+}
+
+func (c *lru) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry{key: key, value: value, size: sizeOf(value) + len(key)}
+	if int64(entry.size) > c.maxBytes && !c.pinned[key] {
+		// value exceeding the whole budget would only evict everything else
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+		return
+	}
+	if c.expiration > 0 && !c.pinned[key] {
+		entry.expires = time.Now().Add(c.expiration)
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += int64(entry.size)
+	c.evict()
+}
+
+// evict removes the least recently used entries until the cache fits in its budget, expired entries first
+func (c *lru) evict() {
+	if c.bytes <= c.maxBytes {
+		return
+	}
+	c.removeExpired(time.Now())
+
+	for element := c.order.Back(); element != nil && c.bytes > c.maxBytes; {
+		prev := element.Prev()
+		if !c.pinned[element.Value.(*lruEntry).key] {
+			c.remove(element)
+			c.evictions++
+		}
+		element = prev
+	}
+}
+
+func (c *lru) Items() []CacheItem {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeExpired(time.Now())
+
+	items := make([]CacheItem, 0, len(c.entries))
+	for key, element := range c.entries {
+		entry := element.Value.(*lruEntry)
+		items = append(items, CacheItem{Key: key, Size: entry.size, Expires: entry.expires, Pinned: c.pinned[key]})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items
+}
+
+func (c *lru) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeExpired(time.Now())
+
+	return CacheStats{
+		Items:     len(c.entries),
+		Bytes:     c.bytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+func (c *lru) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	c.remove(element)
+	if c.expired(element.Value.(*lruEntry), time.Now()) {
+		// expired entry is already missing for readers
+		c.evictions++
+		return false
+	}
+	return true
+}
+
+func (c *lru) DeletePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deleted := 0
+	now := time.Now()
+	for key, element := range c.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		c.remove(element)
+		if c.expired(element.Value.(*lruEntry), now) {
+			c.evictions++
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+func (c *lru) Flush() int {
+	return c.DeletePrefix("")
+}
+
+func (c *lru) Pin(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pinned[key] = true
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).expires = time.Time{}
+	}
+}
+
+func (c *lru) Unpin(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pinned, key)
+	if element, ok := c.entries[key]; ok && c.expiration > 0 {
+		element.Value.(*lruEntry).expires = time.Now().Add(c.expiration)
+	}
+	c.evict()
+}
@@ -0,0 +1,87 @@
+package gutenbergsearch
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCacheBudget(t *testing.T) {
+	// every book takes 12 bytes of key and 88 bytes of content
+	book := strings.Repeat("x", 88)
+	c := NewCache(true, time.Hour, time.Hour, 300)
+
+	c.Set("/ebooks/0001", book)
+	c.Set("/ebooks/0002", book)
+	c.Set("/ebooks/0003", book)
+	assert.Equal(t, CacheStats{Items: 3, Bytes: 300}, c.Stats())
+
+	// recently used book is kept, the least recently used one is evicted
+	_, ok := c.Get("/ebooks/0001")
+	assert.True(t, ok)
+	c.Set("/ebooks/0004", book)
+	_, ok = c.Get("/ebooks/0002")
+	assert.False(t, ok)
+
+	// pinned book is not evicted even if it was not used for a long time
+	c.Pin("/ebooks/0003")
+	c.Set("/ebooks/0005", book)
+	c.Set("/ebooks/0006", book)
+
+	var keys []string
+	for _, item := range c.Items() {
+		keys = append(keys, item.Key)
+	}
+	assert.Equal(t, []string{"/ebooks/0003", "/ebooks/0005", "/ebooks/0006"}, keys)
+	assert.Equal(t, CacheStats{Items: 3, Bytes: 300, Hits: 1, Misses: 1, Evictions: 3}, c.Stats())
+
+	// values over the whole budget are not cached
+	c.Set("/ebooks/0007", strings.Repeat("x", 300))
+	_, ok = c.Get("/ebooks/0007")
+	assert.False(t, ok)
+	assert.Equal(t, int64(300), c.Stats().Bytes)
+}
+
+func TestLRUCacheExpiration(t *testing.T) {
+	c := NewCache(true, time.Millisecond*10, time.Hour, 1000)
+	c.Set("/ebooks/1513", "Romeo and Juliet")
+	c.Set("/ebooks/84", "Frankenstein")
+	c.Pin("/ebooks/84")
+
+	time.Sleep(time.Millisecond * 20)
+	_, ok := c.Get("/ebooks/1513")
+	assert.False(t, ok)
+	_, ok = c.Get("/ebooks/84")
+	assert.True(t, ok)
+	assert.Equal(t, CacheStats{Items: 1, Bytes: 22, Hits: 1, Misses: 1, Evictions: 1}, c.Stats())
+}
+
+func TestLRUCacheCleanup(t *testing.T) {
+	c := NewCache(true, time.Millisecond*10, time.Millisecond*5, 1000)
+	c.Set("/ebooks/1513", "Romeo and Juliet")
+	c.Set("/ebooks/84", "Frankenstein")
+	c.Pin("/ebooks/84")
+
+	// expired entries are removed without reading or listing the cache
+	time.Sleep(time.Millisecond * 50)
+	lru := c.(*lruCache)
+	lru.mu.Lock()
+	assert.Equal(t, int64(22), lru.bytes)
+	assert.Len(t, lru.entries, 1)
+	lru.mu.Unlock()
+}
+
+func TestLRUCacheDeleteExpired(t *testing.T) {
+	c := NewCache(true, time.Millisecond*10, time.Hour, 1000)
+	c.Set("/ebooks/1513", "Romeo and Juliet")
+	c.Set("/ebooks/1524", "Hamlet")
+	c.Set("/ebooks/84", "Frankenstein")
+	c.Pin("/ebooks/84")
+
+	time.Sleep(time.Millisecond * 20)
+	assert.False(t, c.Delete("/ebooks/1513"))
+	assert.Equal(t, 1, c.DeletePrefix("/ebooks/"))
+	assert.Equal(t, CacheStats{Evictions: 2}, c.Stats())
+}
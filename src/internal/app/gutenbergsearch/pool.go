@@ -0,0 +1,168 @@
+package gutenbergsearch
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+)
+
+// downloadPoolMetrics are published under "download_pool" key of /debug/vars
+var downloadPoolMetrics = expvar.NewMap("download_pool")
+
+var errPoolClosed = errors.New("download pool closed")
+
+// downloadPriority orders queued downloads, books requested by searches are downloaded before background ones
+type downloadPriority int
+
+const (
+	priorityInteractive downloadPriority = iota
+	priorityBackground
+	priorities
+)
+
+func (p downloadPriority) String() string {
+	if p == priorityBackground {
+		return "background"
+	}
+	return "interactive"
+}
+
+type poolTask struct {
+	fn       func()
+	priority downloadPriority // guarded by the pool
+	done     chan struct{}
+	err      error // errPoolClosed if the task was dropped
+}
+
+func newPoolTask(priority downloadPriority, fn func()) *poolTask {
+	return &poolTask{fn: fn, priority: priority, done: make(chan struct{})}
+}
+
+// downloadPool runs downloads on a fixed number of workers, so the number of parallel upstream downloads does not
+// grow with the number of concurrent searches. Tasks of the same priority are run in order of submission, and as every
+// search waits for its download before it submits the next one, searches are served in turns.
+type downloadPool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues [priorities][]*poolTask
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newDownloadPool(workers int) *downloadPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &downloadPool{}
+	p.cond = sync.NewCond(&p.mu)
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *downloadPool) work() {
+	defer p.wg.Done()
+	for {
+		task, ok := p.next()
+		if !ok {
+			return
+		}
+		downloadPoolMetrics.Add("active", 1)
+		task.fn()
+		downloadPoolMetrics.Add("active", -1)
+		downloadPoolMetrics.Add("completed", 1)
+		close(task.done)
+	}
+}
+
+// next waits for a task of the highest priority, false is returned once the pool is closed
+func (p *downloadPool) next() (*poolTask, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if p.closed {
+			return nil, false
+		}
+		for priority := range p.queues {
+			if queue := p.queues[priority]; len(queue) > 0 {
+				p.queues[priority] = queue[1:]
+				downloadPoolMetrics.Add("queued_"+downloadPriority(priority).String(), -1)
+				return queue[0], true
+			}
+		}
+		p.cond.Wait()
+	}
+}
+
+// run queues fn with given priority and waits until a worker runs it
+func (p *downloadPool) run(priority downloadPriority, fn func()) error {
+	return p.runTask(newPoolTask(priority, fn))
+}
+
+// runTask queues the task with its priority and waits until a worker runs it
+func (p *downloadPool) runTask(task *poolTask) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errPoolClosed
+	}
+	p.queues[task.priority] = append(p.queues[task.priority], task)
+	downloadPoolMetrics.Add("queued_"+task.priority.String(), 1)
+	p.cond.Signal()
+	p.mu.Unlock()
+
+	<-task.done
+	return task.err
+}
+
+// raise moves the task to the queue of given priority if it is higher than its own, so a download shared by
+// a search does not wait behind other searches when it was started in the background. Task not queued yet is
+// queued with the raised priority.
+func (p *downloadPool) raise(task *poolTask, priority downloadPriority) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if priority >= task.priority {
+		return
+	}
+
+	queue := p.queues[task.priority]
+	for i, queued := range queue {
+		if queued == task {
+			p.queues[task.priority] = append(queue[:i:i], queue[i+1:]...)
+			p.queues[priority] = append(p.queues[priority], task)
+			downloadPoolMetrics.Add("queued_"+task.priority.String(), -1)
+			downloadPoolMetrics.Add("queued_"+priority.String(), 1)
+			break
+		}
+	}
+	task.priority = priority
+}
+
+// priorityOf returns current priority of the task, it is higher than the one of its creation if it was raised
+func (p *downloadPool) priorityOf(task *poolTask) downloadPriority {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return task.priority
+}
+
+// close stops workers once they finish running tasks, queued tasks are dropped and their callers are released
+func (p *downloadPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	var dropped []*poolTask
+	for priority, queue := range p.queues {
+		dropped = append(dropped, queue...)
+		downloadPoolMetrics.Add("queued_"+downloadPriority(priority).String(), int64(-len(queue)))
+		p.queues[priority] = nil
+	}
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	for _, task := range dropped {
+		task.err = errPoolClosed
+		close(task.done)
+	}
+	p.wg.Wait()
+}
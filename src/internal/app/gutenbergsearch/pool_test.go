@@ -0,0 +1,288 @@
+package gutenbergsearch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadPoolPriority(t *testing.T) {
+	pool := newDownloadPool(1)
+
+	// the only worker is kept busy until all other tasks are queued
+	release := make(chan struct{})
+	busy := make(chan struct{})
+	go func() {
+		_ = pool.run(priorityBackground, func() {
+			close(busy)
+			<-release
+		})
+	}()
+	<-busy
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	submit := func(name string, priority downloadPriority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pool.run(priority, func() {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+			})
+			assert.Nil(t, err)
+		}()
+	}
+	queued := func(n int) {
+		for {
+			pool.mu.Lock()
+			depth := len(pool.queues[priorityInteractive]) + len(pool.queues[priorityBackground])
+			pool.mu.Unlock()
+			if depth == n {
+				return
+			}
+		}
+	}
+
+	submit("warm 1", priorityBackground)
+	queued(1)
+	submit("search A", priorityInteractive)
+	queued(2)
+	submit("search B", priorityInteractive)
+	queued(3)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, []string{"search A", "search B", "warm 1"}, order)
+
+	pool.close()
+	assert.Equal(t, errPoolClosed, pool.run(priorityInteractive, func() {
+		t.Error("task run by closed pool")
+	}))
+}
+
+func TestDownloadPoolRaise(t *testing.T) {
+	pool := newDownloadPool(1)
+	defer pool.close()
+
+	release := make(chan struct{})
+	busy := make(chan struct{})
+	go func() {
+		_ = pool.run(priorityBackground, func() {
+			close(busy)
+			<-release
+		})
+	}()
+	<-busy
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	submit := func(task *poolTask) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, pool.runTask(task))
+		}()
+	}
+	newTask := func(name string, priority downloadPriority) *poolTask {
+		return newPoolTask(priority, func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		})
+	}
+	queued := func(priority downloadPriority, n int) {
+		for {
+			pool.mu.Lock()
+			depth := len(pool.queues[priority])
+			pool.mu.Unlock()
+			if depth == n {
+				return
+			}
+		}
+	}
+
+	warm1, warm2, warm3 := newTask("warm 1", priorityBackground), newTask("warm 2", priorityBackground),
+		newTask("warm 3", priorityBackground)
+	submit(warm1)
+	queued(priorityBackground, 1)
+	submit(warm2)
+	queued(priorityBackground, 2)
+	submit(newTask("search A", priorityInteractive))
+	queued(priorityInteractive, 1)
+
+	// a search joins download of warm 2, lower priority does not demote it
+	pool.raise(warm2, priorityInteractive)
+	pool.raise(warm2, priorityBackground)
+	queued(priorityInteractive, 2)
+	// task raised before it is queued
+	pool.raise(warm3, priorityInteractive)
+	submit(warm3)
+	queued(priorityInteractive, 3)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, []string{"search A", "warm 2", "warm 3", "warm 1"}, order)
+}
+
+func TestDownloadPoolBounded(t *testing.T) {
+	const workers = 3
+	pool := newDownloadPool(workers)
+	defer pool.close()
+
+	var mu sync.Mutex
+	var active, maxActive int
+	started := make(chan struct{}, 20)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = pool.run(priorityInteractive, func() {
+				mu.Lock()
+				active++
+				if active > maxActive {
+					maxActive = active
+				}
+				mu.Unlock()
+
+				started <- struct{}{}
+				<-release
+
+				mu.Lock()
+				active--
+				mu.Unlock()
+			})
+		}()
+	}
+
+	// tasks are held until all workers are busy, no more tasks may be started meanwhile
+	for i := 0; i < workers; i++ {
+		<-started
+	}
+	time.Sleep(time.Millisecond * 50)
+	assert.Len(t, started, 0)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, workers, maxActive)
+}
+
+func TestDownloadSharedRaise(t *testing.T) {
+	provider := &popularProviderMock{}
+	s := &searcher{
+		contentCache: newContentStore(NewCache(true, time.Hour, time.Hour, 0)),
+		dataProvider: provider,
+		retryPolicy:  RetryPolicy{Attempts: 1},
+		downloadPool: newDownloadPool(1),
+		exit:         make(chan bool),
+	}
+	defer s.downloadPool.close()
+
+	release := make(chan struct{})
+	busy := make(chan struct{})
+	go func() {
+		_ = s.downloadPool.run(priorityBackground, func() {
+			close(busy)
+			<-release
+		})
+	}()
+	<-busy
+
+	queued := func(priority downloadPriority, n int) {
+		for {
+			s.downloadPool.mu.Lock()
+			depth := len(s.downloadPool.queues[priority])
+			s.downloadPool.mu.Unlock()
+			if depth == n {
+				return
+			}
+		}
+	}
+
+	books := mockBooks([]int{1513, 84, 1524})
+	warm1 := s.downloadShared(downloadRequest{book: books[0]}, priorityBackground)
+	warm2 := s.downloadShared(downloadRequest{book: books[1]}, priorityBackground)
+	queued(priorityBackground, 2)
+	search := s.downloadShared(downloadRequest{book: books[2]}, priorityInteractive)
+	queued(priorityInteractive, 1)
+	// a search joins the background download
+	joined := s.downloadShared(downloadRequest{book: books[1]}, priorityInteractive)
+	assert.Equal(t, warm2, joined)
+	queued(priorityInteractive, 2)
+
+	close(release)
+	for _, call := range []*flightCall{warm1, warm2, search} {
+		<-call.done
+		assert.Nil(t, call.err)
+	}
+	assert.Equal(t, []string{"/ebooks/1524", "/ebooks/84", "/ebooks/1513"}, provider.downloads)
+	assert.Empty(t, s.downloadTasks)
+}
+
+// flakyProviderMock fails the first download of every book in failing set with a transient error
+type flakyProviderMock struct {
+	popularProviderMock
+	failing map[string]bool
+}
+
+func (p *flakyProviderMock) DownloadBook(book data.Book) (string, error) {
+	content, _ := p.popularProviderMock.DownloadBook(book)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failing[book.ID()] {
+		delete(p.failing, book.ID())
+		return "", errors.New("connection reset")
+	}
+	return content, nil
+}
+
+func TestDownloadSharedRetryReleasesWorker(t *testing.T) {
+	provider := &flakyProviderMock{failing: map[string]bool{"/ebooks/1513": true}}
+	s := &searcher{
+		contentCache: newContentStore(NewCache(true, time.Hour, time.Hour, 0)),
+		dataProvider: provider,
+		retryPolicy:  RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond * 400, MaxDelay: time.Millisecond * 400},
+		downloadPool: newDownloadPool(1),
+		exit:         make(chan bool),
+	}
+	defer s.downloadPool.close()
+
+	downloaded := func() []string {
+		provider.mu.Lock()
+		defer provider.mu.Unlock()
+		return append([]string{}, provider.downloads...)
+	}
+
+	books := mockBooks([]int{1513, 84})
+	warm := s.downloadShared(downloadRequest{book: books[0]}, priorityBackground)
+	for len(downloaded()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the only worker is free while the failed download waits for its retry
+	search := s.downloadShared(downloadRequest{book: books[1]}, priorityInteractive)
+	<-search.done
+	assert.Nil(t, search.err)
+	assert.Equal(t, []string{"/ebooks/1513", "/ebooks/84"}, downloaded())
+
+	// retry keeps priority raised by a search joining the download
+	joined := s.downloadShared(downloadRequest{book: books[0]}, priorityInteractive)
+	assert.Equal(t, warm, joined)
+	s.downloadTasksMu.Lock()
+	assert.Equal(t, priorityInteractive, s.downloadPool.priorityOf(s.downloadTasks["/ebooks/1513"]))
+	s.downloadTasksMu.Unlock()
+
+	<-warm.done
+	assert.Nil(t, warm.err)
+	assert.Equal(t, []string{"/ebooks/1513", "/ebooks/84", "/ebooks/1513"}, downloaded())
+	assert.Empty(t, s.downloadTasks)
+}
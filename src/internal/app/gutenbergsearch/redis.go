@@ -0,0 +1,571 @@
+package gutenbergsearch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// redisMetrics are published under "redis_cache" key of /debug/vars
+var redisMetrics = expvar.NewMap("redis_cache")
+
+// redisMaxIdle is number of idle connections kept open by RedisClient
+const redisMaxIdle = 8
+
+// redisScanCount is number of keys requested from Redis by every SCAN call
+const redisScanCount = 1000
+
+// redisPinsKey is a set of pinned keys of a cache, kept under prefix of the cache but not listed among its values
+const redisPinsKey = "pins"
+
+// Stored values start with a byte telling how they are encoded
+const (
+	redisRaw  byte = 'r'
+	redisGzip byte = 'z'
+)
+
+var errRedisClosed = errors.New("redis client closed")
+
+// redisError is an error reply of Redis server, the connection can be still used after it
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// RedisClient sends commands to Redis or Redis-compatible server, connections are pooled and shared by all caches
+// using the client
+type RedisClient struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+// NewRedisClient connects to Redis server at addr (host:port), password is optional and db selects the database.
+// Every command is given up after timeout.
+func NewRedisClient(addr, password string, db int, timeout time.Duration) (*RedisClient, error) {
+	c := &RedisClient{addr: addr, password: password, db: db, timeout: timeout}
+	if _, err := c.do("PING"); err != nil {
+		return nil, fmt.Errorf("connecting to redis %s failed: %w", addr, err)
+	}
+	return c, nil
+}
+
+// Close closes idle connections, connections in use are closed once their commands finish
+func (c *RedisClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, conn := range c.idle {
+		_ = conn.conn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+func (c *RedisClient) get() (*redisConn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errRedisClosed
+	}
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+	return c.dial()
+}
+
+func (c *RedisClient) put(conn *redisConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= redisMaxIdle {
+		_ = conn.conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+func (c *RedisClient) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if c.password != "" {
+		if _, err := c.command(conn, "AUTH", c.password); err != nil {
+			_ = netConn.Close()
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.command(conn, "SELECT", c.db); err != nil {
+			_ = netConn.Close()
+			return nil, fmt.Errorf("selecting database %d failed: %w", c.db, err)
+		}
+	}
+	return conn, nil
+}
+
+// do sends a command and returns its reply: string for status, int64 for integer, []byte for bulk string (nil if
+// missing) and []interface{} for array replies
+func (c *RedisClient) do(args ...interface{}) (interface{}, error) {
+	conn, err := c.get()
+	if err != nil {
+		redisMetrics.Add("errors", 1)
+		return nil, err
+	}
+	reply, err := c.command(conn, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// state of the connection is unknown
+		_ = conn.conn.Close()
+		redisMetrics.Add("errors", 1)
+		return nil, err
+	}
+	c.put(conn)
+	return reply, err
+}
+
+// pipeline sends commands at once and returns their replies in order, error replies are returned in place of
+// their values
+func (c *RedisClient) pipeline(commands [][]interface{}) ([]interface{}, error) {
+	conn, err := c.get()
+	if err != nil {
+		redisMetrics.Add("errors", 1)
+		return nil, err
+	}
+	replies, err := c.commands(conn, commands)
+	if err != nil {
+		_ = conn.conn.Close()
+		redisMetrics.Add("errors", 1)
+		return nil, err
+	}
+	c.put(conn)
+	return replies, nil
+}
+
+func (c *RedisClient) commands(conn *redisConn, commands [][]interface{}) ([]interface{}, error) {
+	if c.timeout > 0 {
+		if err := conn.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	for _, args := range commands {
+		buf.Write(encodeCommand(args...))
+	}
+	if _, err := conn.conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, 0, len(commands))
+	for range commands {
+		reply, err := readReply(conn.reader)
+		var replyErr redisError
+		if errors.As(err, &replyErr) {
+			reply, err = replyErr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+func (c *RedisClient) command(conn *redisConn, args ...interface{}) (interface{}, error) {
+	replies, err := c.commands(conn, [][]interface{}{args})
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := replies[0].(redisError); ok {
+		return nil, replyErr
+	}
+	return replies[0], nil
+}
+
+// encodeCommand encodes arguments as RESP array of bulk strings
+func encodeCommand(args ...interface{}) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var value []byte
+		switch v := arg.(type) {
+		case []byte:
+			value = v
+		case string:
+			value = []byte(v)
+		default:
+			value = []byte(fmt.Sprint(v))
+		}
+		fmt.Fprintf(&buf, "$%d\r\n", len(value))
+		buf.Write(value)
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			value, err := readReply(r)
+			var replyErr redisError
+			if err != nil && !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unknown redis reply type %q", kind)
+}
+
+// redisCache keeps values in Redis under keys of its prefix, so they are shared by all replicas of the service.
+// Only string and []byte values can be cached, typed caches encode their values before. Redis failures are logged
+// and treated as missing values. Pinned keys are kept in a Redis set shared by all replicas, their values never expire.
+type redisCache struct {
+	hits, misses int64 // updated atomically
+
+	client     *RedisClient
+	prefix     string
+	expiration time.Duration
+	compress   bool
+}
+
+// NewRedisCache returns cache keeping values in Redis under keys starting with prefix (eg. "fuzzy-search:content:"),
+// values expire after expiration (0 keeps them until Redis evicts them) and are gzip compressed if compress is set
+func NewRedisCache(client *RedisClient, prefix string, expiration time.Duration, compress bool) AdminCache {
+	return &redisCache{
+		client:     client,
+		prefix:     prefix,
+		expiration: expiration,
+		compress:   compress,
+	}
+}
+
+// pipeline sends commands at once, failures are logged and replies of failed commands are nil
+func (c *redisCache) pipeline(action, key string, commands ...[]interface{}) []interface{} {
+	replies, err := c.client.pipeline(commands)
+	if err != nil {
+		log.Printf("[Redis] %s key %s failed: %s", action, c.prefix+key, err)
+		return make([]interface{}, len(commands))
+	}
+	for i, reply := range replies {
+		if replyErr, ok := reply.(redisError); ok {
+			log.Printf("[Redis] %s key %s failed: %s", action, c.prefix+key, replyErr)
+			replies[i] = nil
+		}
+	}
+	return replies
+}
+
+func (c *redisCache) External() bool { return true }
+
+func (c *redisCache) Get(key string) (interface{}, bool) {
+	reply, err := c.client.do("GET", c.prefix+key)
+	raw, _ := reply.([]byte)
+	if err != nil || raw == nil {
+		if err != nil {
+			log.Printf("[Redis] Getting key %s failed: %s", c.prefix+key, err)
+		}
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+
+	value, err := decodeRedisValue(raw)
+	if err != nil {
+		log.Printf("[Redis] Decoding key %s failed: %s", c.prefix+key, err)
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return value, true
+}
+
+func (c *redisCache) Set(key string, value interface{}) {
+	var raw []byte
+	switch v := value.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		log.Printf("[Redis] Unexpected %T value of key %s", value, c.prefix+key)
+		return
+	}
+
+	encoded, err := encodeRedisValue(raw, c.compress)
+	if err != nil {
+		log.Printf("[Redis] Encoding key %s failed: %s", c.prefix+key, err)
+		return
+	}
+	if c.expiration <= 0 {
+		if _, err := c.client.do("SET", c.prefix+key, encoded); err != nil {
+			log.Printf("[Redis] Setting key %s failed: %s", c.prefix+key, err)
+		}
+		return
+	}
+
+	// pin is checked after the value is set, so a key pinned meanwhile by another replica is persisted either by
+	// the replica pinning it or here
+	replies := c.pipeline("Setting", key,
+		[]interface{}{"SET", c.prefix + key, encoded, "PX", c.expiration.Milliseconds()},
+		[]interface{}{"SISMEMBER", c.prefix + redisPinsKey, key},
+	)
+	if pinned, _ := replies[1].(int64); pinned == 1 {
+		c.pipeline("Pinning", key, []interface{}{"PERSIST", c.prefix + key})
+	}
+}
+
+// pinned returns set of pinned keys
+func (c *redisCache) pinned() map[string]bool {
+	pinned := make(map[string]bool)
+	reply, err := c.client.do("SMEMBERS", c.prefix+redisPinsKey)
+	if err != nil {
+		log.Printf("[Redis] Reading pins of %s failed: %s", c.prefix, err)
+		return pinned
+	}
+	members, _ := reply.([]interface{})
+	for _, member := range members {
+		if key, ok := member.([]byte); ok {
+			pinned[string(key)] = true
+		}
+	}
+	return pinned
+}
+
+// keys returns keys of the cache starting with prefix, without prefix of the cache
+func (c *redisCache) keys(prefix string) ([]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := c.client.do("SCAN", cursor, "MATCH", escapeRedisPattern(c.prefix+prefix)+"*",
+			"COUNT", redisScanCount)
+		if err != nil {
+			return nil, err
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 2 {
+			return nil, fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+		next, _ := values[0].([]byte)
+		found, _ := values[1].([]interface{})
+		for _, key := range found {
+			if key, ok := key.([]byte); ok && string(key) != c.prefix+redisPinsKey {
+				keys = append(keys, strings.TrimPrefix(string(key), c.prefix))
+			}
+		}
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// escapeRedisPattern escapes glob-style special characters of Redis patterns
+func escapeRedisPattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Items reports size of values as they are stored in Redis, ie. compressed. Sizes and expiration times are
+// requested with pipelined commands, one round trip per redisScanCount keys.
+func (c *redisCache) Items() []CacheItem {
+	keys, err := c.keys("")
+	if err != nil {
+		log.Printf("[Redis] Listing keys of %s failed: %s", c.prefix, err)
+		return []CacheItem{}
+	}
+
+	pinned := c.pinned()
+	items := make([]CacheItem, 0, len(keys))
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > redisScanCount {
+			batch = batch[:redisScanCount]
+		}
+		keys = keys[len(batch):]
+
+		commands := make([][]interface{}, 0, len(batch)*2)
+		for _, key := range batch {
+			commands = append(commands, []interface{}{"STRLEN", c.prefix + key}, []interface{}{"PTTL", c.prefix + key})
+		}
+		replies, err := c.client.pipeline(commands)
+		if err != nil {
+			log.Printf("[Redis] Reading keys of %s failed: %s", c.prefix, err)
+			return items
+		}
+
+		now := time.Now()
+		for i, key := range batch {
+			size, _ := replies[2*i].(int64)
+			ttl, ok := replies[2*i+1].(int64)
+			if !ok || ttl == -2 {
+				// expired or deleted meanwhile
+				continue
+			}
+			item := CacheItem{Key: key, Size: int(size), Pinned: pinned[key]}
+			if ttl >= 0 {
+				item.Expires = now.Add(time.Duration(ttl) * time.Millisecond)
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Stats does not report evictions, Redis expires and evicts values on its own
+func (c *redisCache) Stats() CacheStats {
+	stats := CacheStats{Hits: atomic.LoadInt64(&c.hits), Misses: atomic.LoadInt64(&c.misses)}
+	for _, item := range c.Items() {
+		stats.Items++
+		stats.Bytes += int64(item.Size)
+	}
+	return stats
+}
+
+func (c *redisCache) Delete(key string) bool {
+	reply, err := c.client.do("DEL", c.prefix+key)
+	if err != nil {
+		log.Printf("[Redis] Deleting key %s failed: %s", c.prefix+key, err)
+		return false
+	}
+	deleted, _ := reply.(int64)
+	return deleted > 0
+}
+
+func (c *redisCache) DeletePrefix(prefix string) int {
+	keys, err := c.keys(prefix)
+	if err != nil {
+		log.Printf("[Redis] Listing keys of %s failed: %s", c.prefix+prefix, err)
+		return 0
+	}
+	deleted := 0
+	for _, key := range keys {
+		if c.Delete(key) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (c *redisCache) Flush() int {
+	return c.DeletePrefix("")
+}
+
+func (c *redisCache) Pin(key string) {
+	c.pipeline("Pinning", key,
+		[]interface{}{"SADD", c.prefix + redisPinsKey, key},
+		[]interface{}{"PERSIST", c.prefix + key},
+	)
+}
+
+func (c *redisCache) Unpin(key string) {
+	commands := [][]interface{}{{"SREM", c.prefix + redisPinsKey, key}}
+	if c.expiration > 0 {
+		commands = append(commands, []interface{}{"PEXPIRE", c.prefix + key, c.expiration.Milliseconds()})
+	}
+	c.pipeline("Unpinning", key, commands...)
+}
+
+func encodeRedisValue(value []byte, compress bool) ([]byte, error) {
+	if !compress {
+		return append([]byte{redisRaw}, value...), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(redisGzip)
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRedisValue(stored []byte) ([]byte, error) {
+	if len(stored) == 0 {
+		return nil, errors.New("empty value")
+	}
+	switch stored[0] {
+	case redisRaw:
+		return stored[1:], nil
+	case redisGzip:
+		r, err := gzip.NewReader(bytes.NewReader(stored[1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unknown encoding %q", stored[0])
+}
@@ -0,0 +1,197 @@
+package gutenbergsearch
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRedisClient connects to Redis server given by TEST_REDIS_ADDR variable, or to in-process miniredis otherwise.
+// Returned expire function lets given time pass for expiration of keys.
+func testRedisClient(t *testing.T) (*RedisClient, func(time.Duration), func()) {
+	if addr := os.Getenv("TEST_REDIS_ADDR"); addr != "" {
+		client, err := NewRedisClient(addr, os.Getenv("TEST_REDIS_PASSWORD"), 0, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client, time.Sleep, func() { _ = client.Close() }
+	}
+
+	server := newTestRedisServer(t, "secret")
+	client, err := NewRedisClient(server.Addr(), "secret", 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server.FastForward, func() {
+		_ = client.Close()
+		server.Close()
+	}
+}
+
+func newTestRedisServer(t *testing.T, password string) *miniredis.Miniredis {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.RequireAuth(password)
+	return server
+}
+
+func TestRedisClientAuth(t *testing.T) {
+	server := newTestRedisServer(t, "secret")
+	defer server.Close()
+
+	_, err := NewRedisClient(server.Addr(), "wrong", 0, time.Second)
+	assert.NotNil(t, err)
+	_, err = NewRedisClient(server.Addr(), "", 0, time.Second)
+	assert.NotNil(t, err)
+
+	client, err := NewRedisClient(server.Addr(), "secret", 0, time.Second)
+	if assert.Nil(t, err) {
+		_, err = client.do("UNKNOWN")
+		if assert.IsType(t, redisError(""), err) {
+			assert.True(t, strings.HasPrefix(string(err.(redisError)), "ERR unknown command"))
+		}
+		// the connection is still usable after error reply
+		reply, err := client.do("PING")
+		assert.Nil(t, err)
+		assert.Equal(t, "PONG", reply)
+		replies, err := client.pipeline([][]interface{}{{"PING"}, {"UNKNOWN"}, {"GET", "missing"}})
+		if assert.Nil(t, err) && assert.Len(t, replies, 3) {
+			assert.Equal(t, "PONG", replies[0])
+			assert.IsType(t, redisError(""), replies[1])
+			assert.Nil(t, replies[2])
+		}
+		assert.Nil(t, client.Close())
+		_, err = client.do("PING")
+		assert.Equal(t, errRedisClosed, err)
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	client, expire, closeClient := testRedisClient(t)
+	defer closeClient()
+
+	prefix := fmt.Sprintf("fuzzy-search-test-%d:", time.Now().UnixNano())
+	content := NewRedisCache(client, prefix+"content:", time.Millisecond*200, true)
+	listing := NewRedisCache(client, prefix+"listing:", time.Hour, false)
+	defer content.Flush()
+	defer listing.Flush()
+
+	// values are shared by caches of the same prefix, eg. of other replicas
+	contents := newContentStore(content)
+	cached := cachedContent{content: strings.Repeat("Romeo and Juliet ", 1000), fetched: time.Now().UTC()}
+	contents.Set("/ebooks/1513", cached)
+	got, ok := newContentStore(NewRedisCache(client, prefix+"content:", time.Hour, true)).Get("/ebooks/1513")
+	assert.True(t, ok)
+	assert.Equal(t, cached.content, got.content)
+
+	book, _ := data.NewBook("Romeo and Juliet", "William Shakespeare", "/ebooks/1513")
+	newListingStore(listing).Set("t:romeo", []data.Book{book})
+	books, ok := newListingStore(listing).Get("t:romeo")
+	assert.True(t, ok)
+	assert.Equal(t, []data.Book{book}, books)
+
+	// caches of other prefixes do not see the values
+	_, ok = listing.Get("/ebooks/1513")
+	assert.False(t, ok)
+	listing.Set("[x]*", "pattern characters")
+	assert.Equal(t, 0, listing.DeletePrefix("[y"))
+	assert.Equal(t, 1, listing.DeletePrefix("[x]"))
+
+	// values of unsupported types are not stored
+	content.Set("/ebooks/84", cached)
+	_, ok = content.Get("/ebooks/84")
+	assert.False(t, ok)
+
+	content.Set("index//ebooks/1513", []byte("index"))
+	content.Pin("/ebooks/1513")
+	items := content.Items()
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, "/ebooks/1513", items[0].Key)
+		assert.True(t, items[0].Pinned)
+		assert.True(t, items[0].Expires.IsZero())
+		// compressed
+		assert.Less(t, items[0].Size, len(cached.content)/10)
+		assert.False(t, items[1].Expires.IsZero())
+	}
+
+	expire(time.Millisecond * 300)
+	_, ok = content.Get("index//ebooks/1513")
+	assert.False(t, ok)
+	_, ok = contents.Get("/ebooks/1513")
+	assert.True(t, ok)
+	stats := content.Stats()
+	assert.Equal(t, 1, stats.Items)
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+
+	content.Unpin("/ebooks/1513")
+	assert.False(t, content.Items()[0].Expires.IsZero())
+	assert.True(t, content.Delete("/ebooks/1513"))
+	assert.False(t, content.Delete("/ebooks/1513"))
+	assert.Equal(t, 1, listing.Flush())
+	assert.Empty(t, listing.Items())
+}
+
+func TestRedisCacheSharedPins(t *testing.T) {
+	client, expire, closeClient := testRedisClient(t)
+	defer closeClient()
+
+	// caches of the same prefix, eg. of two replicas
+	prefix := fmt.Sprintf("fuzzy-search-test-%d:content:", time.Now().UnixNano())
+	replicaA := NewRedisCache(client, prefix, time.Millisecond*200, false)
+	replicaB := NewRedisCache(client, prefix, time.Millisecond*200, false)
+	defer replicaA.Flush()
+
+	replicaA.Set("/ebooks/1513", "Romeo and Juliet")
+	replicaA.Pin("/ebooks/1513")
+	// value refreshed by the other replica stays pinned
+	replicaB.Set("/ebooks/1513", "Romeo and Juliet, revalidated")
+	items := replicaB.Items()
+	if assert.Len(t, items, 1) {
+		assert.True(t, items[0].Pinned)
+		assert.True(t, items[0].Expires.IsZero())
+	}
+
+	expire(time.Millisecond * 300)
+	value, ok := replicaA.Get("/ebooks/1513")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("Romeo and Juliet, revalidated"), value)
+
+	// pins are not listed among values and are kept when values are flushed
+	assert.Equal(t, 1, replicaB.Flush())
+	replicaB.Set("/ebooks/1513", "Romeo and Juliet")
+	assert.True(t, replicaA.Items()[0].Pinned)
+
+	replicaB.Unpin("/ebooks/1513")
+	assert.False(t, replicaA.Items()[0].Pinned)
+	expire(time.Millisecond * 300)
+	_, ok = replicaA.Get("/ebooks/1513")
+	assert.False(t, ok)
+	_, _ = client.do("DEL", prefix+redisPinsKey)
+}
+
+func TestRedisValueEncoding(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("input:'%t'", compress), func(t *testing.T) {
+			encoded, err := encodeRedisValue([]byte("Romeo and Juliet"), compress)
+			assert.Nil(t, err)
+			decoded, err := decodeRedisValue(encoded)
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("Romeo and Juliet"), decoded)
+		})
+	}
+
+	_, err := decodeRedisValue([]byte("Romeo and Juliet"))
+	assert.NotNil(t, err)
+	_, err = decodeRedisValue(nil)
+	assert.NotNil(t, err)
+}
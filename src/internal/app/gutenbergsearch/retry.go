@@ -0,0 +1,43 @@
+package gutenbergsearch
+
+import (
+	"math/rand"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+)
+
+// RetryPolicy controls retries of failed book downloads. Permanent failures are not retried, throttled requests are
+// retried after the delay requested by upstream, other transient failures with jittered exponential backoff.
+type RetryPolicy struct {
+	Attempts  int           // number of download attempts, including the first one
+	BaseDelay time.Duration // backoff before the first retry, doubled with every next retry
+	MaxDelay  time.Duration // maximum backoff, downloads requested to wait longer are given up
+}
+
+// backoff returns delay before retry of given failed attempt (counted from 1), false if it should not be retried
+func (p RetryPolicy) backoff(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.Attempts || data.IsPermanent(err) {
+		return 0, false
+	}
+
+	if retryAfter, ok := data.RetryAfter(err); ok {
+		if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+			return 0, false
+		}
+		return retryAfter, true
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0, true
+	}
+	// random half of the delay spreads retries of concurrent downloads in time
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)), true
+}
@@ -0,0 +1,50 @@
+package gutenbergsearch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{Attempts: 4, BaseDelay: time.Second, MaxDelay: time.Second * 3}
+	transient := errors.New("connection reset by peer")
+
+	type testCase struct {
+		attempt  int
+		err      error
+		min, max time.Duration
+		retry    bool
+	}
+
+	testCases := []testCase{
+		{attempt: 1, err: transient, min: time.Millisecond * 500, max: time.Second, retry: true},
+		{attempt: 2, err: transient, min: time.Second, max: time.Second * 2, retry: true},
+		{attempt: 3, err: transient, min: time.Millisecond * 1500, max: time.Second * 3, retry: true},
+		{attempt: 4, err: transient, retry: false},
+		{attempt: 1, err: &data.StatusError{StatusCode: http.StatusNotFound}, retry: false},
+		{
+			attempt: 1,
+			err:     &data.StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second * 2},
+			min:     time.Second * 2, max: time.Second * 2, retry: true,
+		}, {
+			attempt: 1,
+			err:     &data.StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Minute},
+			retry:   false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%d %s'", tc.attempt, tc.err), func(t *testing.T) {
+			delay, retry := policy.backoff(tc.attempt, tc.err)
+			assert.Equal(t, tc.retry, retry)
+			assert.True(t, delay >= tc.min && delay <= tc.max, "delay %s out of [%s, %s]", delay, tc.min, tc.max)
+		})
+	}
+}
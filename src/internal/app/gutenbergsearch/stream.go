@@ -0,0 +1,86 @@
+package gutenbergsearch
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+	"fuzzy-search/internal/pkg/search"
+)
+
+// streamTailSize is amount of text following a streamed match kept to put the match into context
+const streamTailSize = 1024
+
+// streams tells whether books can be streamed into search engine instead of being downloaded, that is the case
+// when content is not cached at all, so there is no reason to load the whole text into memory
+func streams(contentCache Cache, dataProvider data.Provider, searchEngine search.Searcher) bool {
+	_, uncached := contentCache.(*dummyCache)
+	_, opens := dataProvider.(data.BookOpener)
+	_, reads := searchEngine.(search.StreamSearcher)
+	return uncached && opens && reads
+}
+
+// searchBook searches phrase in the book and returns the match together with text to put it into context, positions
+// of the match are relative to that text
+func (s *searcher) searchBook(b book, phrase string, opts search.Options, failures *downloadFailures) (search.Result, string, error) {
+	if !s.streamBooks {
+		result, err := s.searchEngine.Search(b.content, phrase, opts)
+		return result, b.content, err
+	}
+
+	result, tail, err := s.streamBook(b.meta, phrase, opts)
+	if err != nil {
+		failures.add(err)
+		return result, "", err
+	}
+	result.PosS, result.PosE = 0, result.PosE-result.PosS
+	return result, tail, nil
+}
+
+// streamBook opens the book on the download pool and searches phrase while its text is read. Failed attempts to
+// open the book are retried the same way as downloads, pool worker is released while waiting for a retry.
+func (s *searcher) streamBook(b data.Book, phrase string, opts search.Options) (search.Result, string, error) {
+	opener := s.dataProvider.(data.BookOpener)
+	engine := s.searchEngine.(search.StreamSearcher)
+
+	for attempt := 1; ; attempt++ {
+		var (
+			result  search.Result
+			tail    string
+			err     error
+			openErr error
+		)
+		// requests are spaced in time by the rate limit of data provider
+		poolErr := s.downloadPool.run(priorityInteractive, func() {
+			var body io.ReadCloser
+			body, openErr = opener.OpenBook(b)
+			if openErr != nil {
+				return
+			}
+			defer body.Close()
+			result, tail, err = engine.SearchReader(body, phrase, opts, streamTailSize)
+		})
+		if poolErr != nil {
+			return search.Result{}, "", poolErr
+		}
+		if openErr == nil {
+			return result, tail, err
+		}
+
+		delay, retry := s.retryPolicy.backoff(attempt, openErr)
+		if !retry {
+			log.Printf("[SWorker] Opening book %s failed after %d attempt(s) (permanent: %t): %s",
+				b.ID(), attempt, data.IsPermanent(openErr), openErr)
+			return search.Result{}, "", openErr
+		}
+		log.Printf("[SWorker] Opening book %s failed: %s (attempt %d/%d, retrying in %s)",
+			b.ID(), openErr, attempt, s.retryPolicy.Attempts, delay)
+
+		select {
+		case <-s.exit:
+			return search.Result{}, "", openErr
+		case <-time.After(delay):
+		}
+	}
+}
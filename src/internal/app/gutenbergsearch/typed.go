@@ -0,0 +1,266 @@
+package gutenbergsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+	"fuzzy-search/internal/pkg/search"
+)
+
+// cacheSchemaVersion has to be increased whenever stored form of cached values changes, values of other versions
+// are then treated as missing instead of being decoded wrongly
+const cacheSchemaVersion = 1
+
+// ExternalCache is implemented by caches keeping values outside of the process, typed caches store values encoded
+// with their schema version in them
+type ExternalCache interface {
+	Cache
+	External() bool
+}
+
+// envelope is stored form of an encoded value
+type envelope struct {
+	Version int             `json:"v"`
+	Kind    string          `json:"kind"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// typedCache keeps values of a single kind in a cache, values are kept as they are in in-memory caches and encoded
+// in external ones. Values of unexpected types, kinds or schema versions are treated as missing.
+type typedCache struct {
+	cache   Cache
+	kind    string // eg. "content"
+	encoded bool
+}
+
+func newTypedCache(cache Cache, kind string) typedCache {
+	external, ok := cache.(ExternalCache)
+	return typedCache{cache: cache, kind: kind, encoded: ok && external.External()}
+}
+
+// get returns cached value, encoded value is decoded into stored which has to be a pointer to stored form
+func (c typedCache) get(key string, stored interface{}) (interface{}, bool) {
+	value, ok := c.cache.Get(key)
+	if !ok || !c.encoded {
+		return value, ok
+	}
+
+	raw, ok := value.([]byte)
+	if !ok {
+		c.unexpected(key, value)
+		return nil, false
+	}
+	var e envelope
+	if err := json.Unmarshal(raw, &e); err != nil {
+		log.Printf("Decoding %s cache key %s failed: %s", c.kind, key, err)
+		return nil, false
+	}
+	if e.Version != cacheSchemaVersion || e.Kind != c.kind {
+		// written by other version of the application
+		return nil, false
+	}
+	if err := json.Unmarshal(e.Data, stored); err != nil {
+		log.Printf("Decoding %s cache key %s failed: %s", c.kind, key, err)
+		return nil, false
+	}
+	return stored, true
+}
+
+// set caches the value, or its stored form if values are encoded
+func (c typedCache) set(key string, value interface{}, stored func() interface{}) {
+	if !c.encoded {
+		c.cache.Set(key, value)
+		return
+	}
+
+	raw, err := c.encode(stored())
+	if err != nil {
+		log.Printf("Encoding %s cache key %s failed: %s", c.kind, key, err)
+		return
+	}
+	c.cache.Set(key, raw)
+}
+
+func (c typedCache) encode(stored interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{Version: cacheSchemaVersion, Kind: c.kind, Data: encoded})
+}
+
+func (c typedCache) unexpected(key string, value interface{}) {
+	log.Printf("Unexpected %T value of %s cache key %s", value, c.kind, key)
+}
+
+// storedBook is stored form of data.Book, including its ID
+type storedBook struct {
+	data.Book
+	Linkref string `json:"linkref"`
+}
+
+func newStoredBook(book data.Book) storedBook {
+	return storedBook{Book: book, Linkref: book.ID()}
+}
+
+func (s storedBook) book() (data.Book, error) {
+	book, err := data.NewBook(s.Title, s.Author, s.Linkref)
+	if err != nil {
+		return data.Book{}, fmt.Errorf("invalid cached book: %w", err)
+	}
+	book.Language = s.Language
+	book.Subjects = s.Subjects
+	book.ReleaseDate = s.ReleaseDate
+	book.Downloads = s.Downloads
+	book.Formats = s.Formats
+	book.CoverURL = s.CoverURL
+	return book, nil
+}
+
+// contentStore caches downloaded content of books by book ID
+type contentStore struct{ typedCache }
+
+type storedContent struct {
+	Content    string          `json:"content"`
+	Validators data.Validators `json:"validators"`
+	Fetched    time.Time       `json:"fetched"`
+}
+
+func newContentStore(cache Cache) contentStore {
+	return contentStore{newTypedCache(cache, "content")}
+}
+
+func (c contentStore) Get(id string) (cachedContent, bool) {
+	value, ok := c.get(id, &storedContent{})
+	if !ok {
+		return cachedContent{}, false
+	}
+	switch v := value.(type) {
+	case cachedContent:
+		return v, true
+	case *storedContent:
+		return cachedContent{content: v.Content, validators: v.Validators, fetched: v.Fetched}, true
+	}
+	c.unexpected(id, value)
+	return cachedContent{}, false
+}
+
+func (c contentStore) Set(id string, content cachedContent) {
+	c.set(id, content, func() interface{} {
+		return storedContent{Content: content.content, Validators: content.validators, Fetched: content.fetched}
+	})
+}
+
+// listingStore caches listed books by query key
+type listingStore struct{ typedCache }
+
+func newListingStore(cache Cache) listingStore {
+	return listingStore{newTypedCache(cache, "listing")}
+}
+
+func (c listingStore) Get(key string) ([]data.Book, bool) {
+	value, ok := c.get(key, &[]storedBook{})
+	if !ok {
+		return nil, false
+	}
+	switch v := value.(type) {
+	case []data.Book:
+		return v, true
+	case *[]storedBook:
+		books := make([]data.Book, 0, len(*v))
+		for _, stored := range *v {
+			book, err := stored.book()
+			if err != nil {
+				log.Printf("Decoding %s cache key %s failed: %s", c.kind, key, err)
+				return nil, false
+			}
+			books = append(books, book)
+		}
+		return books, true
+	}
+	c.unexpected(key, value)
+	return nil, false
+}
+
+func (c listingStore) Set(key string, books []data.Book) {
+	c.set(key, books, func() interface{} {
+		stored := make([]storedBook, 0, len(books))
+		for _, book := range books {
+			stored = append(stored, newStoredBook(book))
+		}
+		return stored
+	})
+}
+
+// detailsStore caches books supplemented with details of their book pages by book ID
+type detailsStore struct{ typedCache }
+
+func newDetailsStore(cache Cache) detailsStore {
+	return detailsStore{newTypedCache(cache, "details")}
+}
+
+func (c detailsStore) Get(key string) (data.Book, bool) {
+	value, ok := c.get(key, &storedBook{})
+	if !ok {
+		return data.Book{}, false
+	}
+	switch v := value.(type) {
+	case data.Book:
+		return v, true
+	case *storedBook:
+		book, err := v.book()
+		if err != nil {
+			log.Printf("Decoding %s cache key %s failed: %s", c.kind, key, err)
+			return data.Book{}, false
+		}
+		return book, true
+	}
+	c.unexpected(key, value)
+	return data.Book{}, false
+}
+
+func (c detailsStore) Set(key string, book data.Book) {
+	c.set(key, book, func() interface{} { return newStoredBook(book) })
+}
+
+// answerStore caches answers by query key
+type answerStore struct{ typedCache }
+
+type storedAnswer struct {
+	Result  string         `json:"result"`
+	Options search.Options `json:"options"`
+	Book    storedBook     `json:"book"`
+}
+
+func newAnswerStore(cache Cache) answerStore {
+	return answerStore{newTypedCache(cache, "answer")}
+}
+
+func (c answerStore) Get(key string) (Answer, bool) {
+	value, ok := c.get(key, &storedAnswer{})
+	if !ok {
+		return Answer{}, false
+	}
+	switch v := value.(type) {
+	case Answer:
+		return v, true
+	case *storedAnswer:
+		book, err := v.Book.book()
+		if err != nil {
+			log.Printf("Decoding %s cache key %s failed: %s", c.kind, key, err)
+			return Answer{}, false
+		}
+		return Answer{Result: v.Result, Options: v.Options, Book: book}, true
+	}
+	c.unexpected(key, value)
+	return Answer{}, false
+}
+
+func (c answerStore) Set(key string, answer Answer) {
+	c.set(key, answer, func() interface{} {
+		return storedAnswer{Result: answer.Result, Options: answer.Options, Book: newStoredBook(answer.Book)}
+	})
+}
@@ -0,0 +1,85 @@
+package gutenbergsearch
+
+import (
+	"testing"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+	"fuzzy-search/internal/pkg/search"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// externalCacheMock keeps values in a map and requires them to be encoded
+type externalCacheMock map[string]interface{}
+
+func (c externalCacheMock) Get(key string) (interface{}, bool) {
+	value, ok := c[key]
+	return value, ok
+}
+
+func (c externalCacheMock) Set(key string, value interface{}) {
+	c[key] = value
+}
+
+func (c externalCacheMock) External() bool { return true }
+
+func TestTypedCachesEncoded(t *testing.T) {
+	cache := externalCacheMock{}
+
+	book, _ := data.NewBook("Romeo and Juliet", "William Shakespeare", "/ebooks/1513")
+	book.Subjects = []string{"Vendetta -- Drama"}
+	book.Formats = []data.Format{{Name: "Plain Text UTF-8", Type: "text/plain", URL: "/ebooks/1513.txt.utf-8"}}
+
+	content := cachedContent{
+		content:    "Romeo and Juliet",
+		validators: data.Validators{ETag: `"v1"`},
+		fetched:    time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+	contents := newContentStore(cache)
+	contents.Set("/ebooks/1513", content)
+	assert.IsType(t, []byte{}, cache["/ebooks/1513"])
+	cached, ok := contents.Get("/ebooks/1513")
+	assert.True(t, ok)
+	assert.Equal(t, content, cached)
+
+	listings := newListingStore(cache)
+	listings.Set("t:romeo", []data.Book{book})
+	books, ok := listings.Get("t:romeo")
+	assert.True(t, ok)
+	assert.Equal(t, []data.Book{book}, books)
+	assert.Equal(t, "/ebooks/1513", books[0].ID())
+
+	answer := Answer{Result: "O Romeo, Romeo!", Options: search.DefaultOptions(), Book: book}
+	answers := newAnswerStore(cache)
+	answers.Set("t:romeo/romeo", answer)
+	cachedAnswer, ok := answers.Get("t:romeo/romeo")
+	assert.True(t, ok)
+	assert.Equal(t, answer, cachedAnswer)
+
+	// values of other kinds, schema versions or formats are missing
+	_, ok = newDetailsStore(cache).Get("t:romeo")
+	assert.False(t, ok)
+	cache["details//ebooks/1513"] = []byte(`{"v":0,"kind":"details","data":{"Title":"Romeo and Juliet"}}`)
+	_, ok = newDetailsStore(cache).Get("details//ebooks/1513")
+	assert.False(t, ok)
+	cache["details//ebooks/1513"] = "Romeo and Juliet"
+	_, ok = newDetailsStore(cache).Get("details//ebooks/1513")
+	assert.False(t, ok)
+}
+
+func TestTypedCachesInMemory(t *testing.T) {
+	cache := NewCache(true, time.Hour, time.Hour, 0)
+	book, _ := data.NewBook("Romeo and Juliet", "William Shakespeare", "/ebooks/1513")
+
+	details := newDetailsStore(cache)
+	details.Set("details//ebooks/1513", book)
+	cachedBook, ok := details.Get("details//ebooks/1513")
+	assert.True(t, ok)
+	assert.Equal(t, book, cachedBook)
+
+	// value of unexpected type does not panic
+	cache.Set("t:romeo", "Romeo and Juliet")
+	_, ok = newListingStore(cache).Get("t:romeo")
+	assert.False(t, ok)
+}
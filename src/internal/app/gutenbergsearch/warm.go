@@ -0,0 +1,201 @@
+package gutenbergsearch
+
+import (
+	"expvar"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+)
+
+// warmupMetrics are published under "cache_warming" key of /debug/vars
+var warmupMetrics = expvar.NewMap("cache_warming")
+
+// WarmupConfig controls background prefetch of books into content cache, so the first searches of popular books do
+// not pay the download latency. Warming runs on startup and then periodically, with lower priority than searches.
+type WarmupConfig struct {
+	IDs        []int         // ebook IDs always kept in the cache
+	Popular    int           // number of books most downloaded from Gutenberg to keep in the cache
+	TopQueries int           // number of book queries most frequent in our searches, their listed books are cached
+	Interval   time.Duration // warming is repeated with the interval, 0 warms on startup only
+}
+
+func (c WarmupConfig) enabled() bool {
+	return len(c.IDs) > 0 || c.Popular > 0 || c.TopQueries > 0
+}
+
+type queryCount struct {
+	query data.BookQuery
+	count int
+}
+
+// queryStatsLimit is the maximum number of distinct book queries counted by queryStats
+const queryStatsLimit = 1000
+
+// queryStats counts book queries of searches since startup. Once queryStatsLimit queries are counted, counts decay
+// by half and queries counted once are forgotten to make room for new ones.
+type queryStats struct {
+	mu     sync.Mutex
+	counts map[string]*queryCount // key: query key
+}
+
+func (q *queryStats) record(query data.BookQuery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.counts == nil {
+		q.counts = make(map[string]*queryCount)
+	}
+	counted, ok := q.counts[query.Key()]
+	if !ok {
+		if len(q.counts) >= queryStatsLimit {
+			q.decay()
+		}
+		counted = &queryCount{query: query}
+		q.counts[query.Key()] = counted
+	}
+	counted.count++
+}
+
+// decay halves the counts and forgets queries counted once, the least frequent query is forgotten if all of them
+// were counted more times
+func (q *queryStats) decay() {
+	var least string
+	for key, counted := range q.counts {
+		counted.count /= 2
+		if counted.count == 0 {
+			delete(q.counts, key)
+			continue
+		}
+		if least == "" || counted.count < q.counts[least].count {
+			least = key
+		}
+	}
+	if len(q.counts) >= queryStatsLimit {
+		delete(q.counts, least)
+	}
+}
+
+// top returns n most frequent queries, the most frequent first
+func (q *queryStats) top(n int) []data.BookQuery {
+	q.mu.Lock()
+	counts := make([]queryCount, 0, len(q.counts))
+	for _, counted := range q.counts {
+		counts = append(counts, *counted)
+	}
+	q.mu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].query.Key() < counts[j].query.Key()
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	queries := make([]data.BookQuery, 0, len(counts))
+	for _, counted := range counts {
+		queries = append(queries, counted.query)
+	}
+	return queries
+}
+
+// warmTask warms content cache on startup and then with configured interval
+func (s *searcher) warmTask() {
+	defer s.tasksWg.Done()
+	log.Print("[[ warmTask running ]]")
+	s.warm()
+	if s.warmup.Interval <= 0 {
+		log.Print("[[ warmTask closed ]]")
+		return
+	}
+
+	ticker := time.NewTicker(s.warmup.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.exit:
+			log.Print("[[ warmTask closed ]]")
+			return
+		case <-ticker.C:
+			s.warm()
+		}
+	}
+}
+
+// warmupBooks collects books to warm: configured IDs, popular books and books of the most frequent queries
+func (s *searcher) warmupBooks() []data.Book {
+	var books []data.Book
+	if len(s.warmup.IDs) > 0 {
+		configured, err := data.BookQuery{IDs: s.warmup.IDs}.Books()
+		if err != nil {
+			log.Printf("[Warmup] Invalid book IDs: %s", err)
+		}
+		books = append(books, configured...)
+	}
+
+	if s.warmup.Popular > 0 {
+		if lister, ok := s.dataProvider.(data.PopularLister); ok {
+			popular, err := lister.PopularBooks(s.warmup.Popular)
+			if err != nil {
+				log.Printf("[Warmup] Listing popular books failed: %s", err)
+			}
+			books = append(books, popular...)
+		} else {
+			log.Print("[Warmup] Data provider does not list popular books")
+		}
+	}
+
+	for _, query := range s.queries.top(s.warmup.TopQueries) {
+		listed, err := s.getBookPositions(query)
+		if err != nil {
+			log.Printf("[Warmup] Listing books for %s failed: %s", query, err)
+			continue
+		}
+		books = append(books, listed...)
+	}
+	return books
+}
+
+// warm downloads books to warm which are not cached yet and revalidates stale ones, one book at a time with
+// background priority so searches are not delayed
+func (s *searcher) warm() {
+	warmupMetrics.Add("runs", 1)
+	startTime := time.Now()
+	var downloaded, failed int
+
+	seen := make(map[string]bool)
+	for _, book := range s.warmupBooks() {
+		if seen[book.ID()] {
+			continue
+		}
+		seen[book.ID()] = true
+
+		request := downloadRequest{book: book}
+		if cached, ok := s.contentCache.Get(book.ID()); ok {
+			if cached.fresh(s.contentMaxAge, time.Now()) {
+				continue
+			}
+			request.stale = &cached
+		}
+
+		call := s.downloadShared(request, priorityBackground)
+		select {
+		case <-s.exit:
+			return
+		case <-call.done:
+		}
+		if call.err != nil {
+			failed++
+			continue
+		}
+		downloaded++
+	}
+
+	warmupMetrics.Add("downloaded", int64(downloaded))
+	warmupMetrics.Add("failed", int64(failed))
+	log.Printf("[Warmup] %d of %d books downloaded (%d failed) in %s",
+		downloaded, len(seen), failed, time.Since(startTime))
+}
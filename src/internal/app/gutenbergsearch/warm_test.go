@@ -0,0 +1,98 @@
+package gutenbergsearch
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"fuzzy-search/internal/pkg/data"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// popularProviderMock lists the same books for every query and counts downloads
+type popularProviderMock struct {
+	mu        sync.Mutex
+	popular   []int
+	listed    []int
+	downloads []string
+}
+
+func mockBooks(ids []int) []data.Book {
+	books, _ := data.BookQuery{IDs: ids}.Books()
+	return books
+}
+
+func (p *popularProviderMock) GetBooks(query data.BookQuery) ([]data.Book, error) {
+	return mockBooks(p.listed), nil
+}
+
+func (p *popularProviderMock) PopularBooks(n int) ([]data.Book, error) {
+	return mockBooks(p.popular[:n]), nil
+}
+
+func (p *popularProviderMock) DownloadBook(book data.Book) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.downloads = append(p.downloads, book.ID())
+	return "content of " + book.ID(), nil
+}
+
+func (p *popularProviderMock) BookDetails(book data.Book) (data.Book, error) {
+	return book, nil
+}
+
+func TestQueryStatsTop(t *testing.T) {
+	var stats queryStats
+	for _, title := range []string{"romeo", "hamlet", "romeo", "faust", "hamlet", "romeo"} {
+		stats.record(data.BookQuery{Title: title})
+	}
+
+	var titles []string
+	for _, query := range stats.top(2) {
+		titles = append(titles, query.Title)
+	}
+	assert.Equal(t, []string{"romeo", "hamlet"}, titles)
+	assert.Len(t, stats.top(10), 3)
+}
+
+func TestQueryStatsLimit(t *testing.T) {
+	var stats queryStats
+	for i := 0; i < 10; i++ {
+		stats.record(data.BookQuery{Title: "romeo"})
+	}
+	for i := 0; i < queryStatsLimit*3/2; i++ {
+		stats.record(data.BookQuery{Title: fmt.Sprintf("title %d", i)})
+	}
+
+	assert.True(t, len(stats.counts) <= queryStatsLimit)
+	assert.Equal(t, "romeo", stats.top(1)[0].Title)
+}
+
+func TestWarm(t *testing.T) {
+	provider := &popularProviderMock{popular: []int{1513, 84, 1342}, listed: []int{1524, 1513}}
+	s := &searcher{
+		listingCache:  newListingStore(NewCache(true, time.Hour, time.Hour, 0)),
+		contentCache:  newContentStore(NewCache(true, time.Hour, time.Hour, 0)),
+		dataProvider:  provider,
+		retryPolicy:   RetryPolicy{Attempts: 1},
+		contentMaxAge: time.Hour,
+		downloadPool:  newDownloadPool(1),
+		warmup:        WarmupConfig{IDs: []int{11}, Popular: 2, TopQueries: 1},
+		exit:          make(chan bool),
+	}
+	defer s.downloadPool.close()
+	s.queries.record(data.BookQuery{Title: "shakespeare"})
+
+	s.warm()
+	assert.Equal(t, []string{"/ebooks/11", "/ebooks/1513", "/ebooks/84", "/ebooks/1524"}, provider.downloads)
+	cached, ok := s.contentCache.Get("/ebooks/84")
+	assert.True(t, ok)
+	assert.Equal(t, "content of /ebooks/84", cached.content)
+
+	// fresh books are not downloaded again
+	provider.downloads = nil
+	s.warm()
+	assert.Empty(t, provider.downloads)
+}
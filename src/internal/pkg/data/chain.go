@@ -0,0 +1,179 @@
+package data
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// chainProvider queries providers in priority order, eg. local directory, offline mirror and live Gutenberg, so
+// frequently used books can be kept local while the long tail is still reachable
+type chainProvider struct {
+	providers []Provider
+}
+
+// NewChainProvider combines given providers, the first one is preferred
+func NewChainProvider(providers ...Provider) Provider {
+	if len(providers) == 1 {
+		return providers[0]
+	}
+	return &chainProvider{providers: providers}
+}
+
+// listingKey identifies a book across providers by its title and author, used for books without ebook ID
+func listingKey(book Book) string {
+	return strings.ToLower(strings.TrimSpace(book.Title)) + "|" + strings.ToLower(strings.TrimSpace(book.Author))
+}
+
+// mergeBooks fills metadata missing in listing entry of preferred provider from entry of another one, book ID of the
+// preferred entry is kept so the book is downloaded from the preferred provider
+func mergeBooks(preferred, other Book) Book {
+	merged := other.withDetails(preferred)
+	merged.bookLinkref = preferred.bookLinkref
+	return merged
+}
+
+// GetBooks merges listings of all providers, books listed by several providers are de-duplicated by ebook ID, or by
+// title and author when ebook ID of a book is not known. Books are ordered by priority of the first provider listing
+// them. Failing providers are skipped, books of the others are returned with PartialError then. Error of the last
+// provider is returned if all of them fail.
+func (c *chainProvider) GetBooks(query BookQuery) ([]Book, error) {
+	books := []Book{}
+	byID := map[int]int{}
+	byKey := map[string]int{}     // all listed books
+	withoutID := map[string]int{} // books listed without ebook ID
+	var lastErr error
+	failed := 0
+
+	for _, provider := range c.providers {
+		listed, err := provider.GetBooks(query)
+		if err != nil {
+			log.Printf("Listing books for %s failed: %s", query, err)
+			lastErr = err
+			failed++
+			continue
+		}
+
+		for _, book := range listed {
+			id, hasID := book.EbookID()
+			key := listingKey(book)
+
+			i, duplicate := -1, false
+			if hasID {
+				if i, duplicate = byID[id]; !duplicate {
+					i, duplicate = withoutID[key]
+				}
+			} else {
+				i, duplicate = byKey[key]
+			}
+
+			if duplicate {
+				books[i] = mergeBooks(books[i], book)
+			} else {
+				i = len(books)
+				books = append(books, book)
+				byKey[key] = i
+				if !hasID {
+					withoutID[key] = i
+				}
+			}
+			if hasID {
+				byID[id] = i
+			}
+		}
+	}
+
+	if failed == len(c.providers) {
+		return []Book{}, lastErr
+	}
+	if failed > 0 {
+		return books, &PartialError{Err: lastErr}
+	}
+	return books, nil
+}
+
+// DownloadBook downloads the book from the first provider having its text, error of the last provider is returned
+// when none of them has it
+func (c *chainProvider) DownloadBook(book Book) (string, error) {
+	var err error
+	for _, provider := range c.providers {
+		var content string
+		content, err = provider.DownloadBook(book)
+		if err == nil {
+			return content, nil
+		}
+	}
+	return "", err
+}
+
+// OpenBook opens the book of the first provider having its text, text of providers not able to stream it is
+// downloaded as a whole
+func (c *chainProvider) OpenBook(book Book) (io.ReadCloser, error) {
+	var err error
+	for _, provider := range c.providers {
+		if opener, ok := provider.(BookOpener); ok {
+			var body io.ReadCloser
+			if body, err = opener.OpenBook(book); err == nil {
+				return body, nil
+			}
+			continue
+		}
+		var content string
+		if content, err = provider.DownloadBook(book); err == nil {
+			return ioutil.NopCloser(strings.NewReader(content)), nil
+		}
+	}
+	return nil, err
+}
+
+// DownloadBookIfModified downloads the book from the first provider having its text, providers not supporting
+// conditional requests download it unconditionally and without validators. Validators are tied to their source, so
+// only the provider which issued them may report the book as not modified.
+func (c *chainProvider) DownloadBookIfModified(book Book, validators Validators) (string, Validators, error) {
+	var err error
+	for _, provider := range c.providers {
+		var content string
+		var fetched Validators
+		if revalidator, ok := provider.(Revalidator); ok {
+			content, fetched, err = revalidator.DownloadBookIfModified(book, validators)
+		} else {
+			content, err = provider.DownloadBook(book)
+		}
+		if err == nil || errors.Is(err, ErrNotModified) {
+			return content, fetched, err
+		}
+	}
+	return "", Validators{}, err
+}
+
+// BookDetails returns details of the first provider knowing the book
+func (c *chainProvider) BookDetails(book Book) (Book, error) {
+	var err error
+	for _, provider := range c.providers {
+		var detailed Book
+		detailed, err = provider.BookDetails(book)
+		if err == nil {
+			return detailed, nil
+		}
+	}
+	return Book{}, err
+}
+
+// PopularBooks returns popular books of the first provider able to list them
+func (c *chainProvider) PopularBooks(n int) ([]Book, error) {
+	err := errors.New("none of providers lists popular books")
+	for _, provider := range c.providers {
+		lister, ok := provider.(PopularLister)
+		if !ok {
+			continue
+		}
+		var books []Book
+		books, err = lister.PopularBooks(n)
+		if err == nil {
+			return books, nil
+		}
+	}
+	return []Book{}, err
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// providerMock serves fixed listing and contents of books by their IDs
+type providerMock struct {
+	books      []Book
+	contents   map[string]string
+	listingErr error
+}
+
+func (p *providerMock) GetBooks(query BookQuery) ([]Book, error) {
+	return p.books, p.listingErr
+}
+
+func (p *providerMock) DownloadBook(book Book) (string, error) {
+	content, ok := p.contents[book.ID()]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", book.ID(), errNotFound)
+	}
+	return content, nil
+}
+
+func (p *providerMock) BookDetails(book Book) (Book, error) {
+	if _, ok := p.contents[book.ID()]; !ok {
+		return Book{}, errNotFound
+	}
+	return book, nil
+}
+
+func TestChainProviderGetBooks(t *testing.T) {
+	localRomeo, _ := NewBook("Romeo and Juliet", "William Shakespeare", "/ebooks/1513")
+	localHamlet, _ := NewBook("Hamlet", "William Shakespeare", "/local/hamlet.txt")
+
+	romeo, _ := NewBook("Romeo and Juliet", "William Shakespeare", "/ebooks/1513")
+	romeo.Downloads = 1000
+	hamlet, _ := NewBook("Hamlet", "William Shakespeare", "/ebooks/1524")
+	otherRomeo, _ := NewBook("Romeo and Juliet", "William Shakespeare", "/ebooks/1112")
+	macbeth, _ := NewBook("Macbeth", "William Shakespeare", "/ebooks/1533")
+
+	provider := NewChainProvider(
+		&providerMock{books: []Book{localRomeo, localHamlet}},
+		&providerMock{listingErr: errors.New("mirror offline")},
+		&providerMock{books: []Book{romeo, hamlet, otherRomeo, macbeth}},
+	)
+
+	books, err := provider.GetBooks(BookQuery{Author: "shakespeare"})
+	var partial *PartialError
+	assert.True(t, errors.As(err, &partial))
+
+	var ids []string
+	for _, book := range books {
+		ids = append(ids, book.ID())
+	}
+	assert.Equal(t, []string{"/ebooks/1513", "/local/hamlet.txt", "/ebooks/1112", "/ebooks/1533"}, ids)
+	// metadata missing locally are filled from other listings
+	assert.Equal(t, 1000, books[0].Downloads)
+
+	failing := NewChainProvider(
+		&providerMock{listingErr: errors.New("first failed")},
+		&providerMock{listingErr: errors.New("second failed")},
+	)
+	_, err = failing.GetBooks(BookQuery{Author: "shakespeare"})
+	assert.EqualError(t, err, "second failed")
+}
+
+func TestChainProviderDownloadBook(t *testing.T) {
+	provider := NewChainProvider(
+		&providerMock{contents: map[string]string{"/ebooks/1513": "local Romeo and Juliet"}},
+		&providerMock{contents: map[string]string{"/ebooks/1513": "Romeo and Juliet", "/ebooks/1524": "Hamlet"}},
+	)
+
+	type testCase struct {
+		linkref  string
+		expected string
+		found    bool
+	}
+
+	testCases := []testCase{
+		{linkref: "/ebooks/1513", expected: "local Romeo and Juliet", found: true},
+		{linkref: "/ebooks/1524", expected: "Hamlet", found: true},
+		{linkref: "/ebooks/1533", found: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.linkref), func(t *testing.T) {
+			book, _ := NewBook("", "", tc.linkref)
+			content, err := provider.DownloadBook(book)
+			assert.Equal(t, tc.expected, content)
+			assert.Equal(t, !tc.found, errors.Is(err, errNotFound))
+
+			content, validators, err := provider.(Revalidator).DownloadBookIfModified(book, Validators{ETag: `"v1"`})
+			assert.Equal(t, tc.expected, content)
+			assert.Equal(t, Validators{}, validators)
+			assert.Equal(t, !tc.found, errors.Is(err, errNotFound))
+
+			body, err := provider.(BookOpener).OpenBook(book)
+			assert.Equal(t, !tc.found, errors.Is(err, errNotFound))
+			if err == nil {
+				streamed, _ := ioutil.ReadAll(body)
+				body.Close()
+				assert.Equal(t, tc.expected, string(streamed))
+			}
+		})
+	}
+}
+
+func TestChainProviderRevalidationSource(t *testing.T) {
+	etag := `"v1"`
+	serve := func(content string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/1/5/1/1513/1513-0.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			_, _ = w.Write([]byte(content))
+		}))
+	}
+	first, second := serve("Romeo and Juliet"), serve("Romeo and Juliet, second edition")
+	defer second.Close()
+
+	provider := NewChainProvider(
+		newTestProvider(t, []string{first.URL}, []string{first.URL}),
+		newTestProvider(t, []string{second.URL}, []string{second.URL}),
+	).(Revalidator)
+	book, _ := NewBook("Romeo and Juliet", "", "/ebooks/1513")
+
+	content, validators, err := provider.DownloadBookIfModified(book, Validators{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Romeo and Juliet", content)
+	_, _, err = provider.DownloadBookIfModified(book, validators)
+	assert.Equal(t, ErrNotModified, err)
+
+	// the other provider did not issue the validators, so it downloads its content in full
+	first.Close()
+	content, fetched, err := provider.DownloadBookIfModified(book, validators)
+	assert.Nil(t, err)
+	assert.Equal(t, "Romeo and Juliet, second edition", content)
+	assert.Equal(t, second.URL+"/1/5/1/1513/1513-0.txt", fetched.Source)
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// maxZipSize limits size of downloaded archive, zip has to be buffered as its directory is stored at the end
+const maxZipSize = 64 * 1024 * 1024
+
+// zipLinkref returns linkref of zipped edition of a plain text file, Gutenberg stores it next to the text file,
+// eg. "/files/1513/1513-0.zip" for "/files/1513/1513-0.txt"
+func zipLinkref(txtLinkref string) (string, bool) {
+	if !strings.HasSuffix(txtLinkref, ".txt") || strings.HasPrefix(txtLinkref, "/cache/") {
+		// generated editions are not zipped
+		return "", false
+	}
+	return strings.TrimSuffix(txtLinkref, ".txt") + ".zip", true
+}
+
+// readCloser combines reader with closers of all the underlying readers
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// decodedBody returns response body decompressed according to its content encoding
+func decodedBody(resp *http.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp.Body, nil
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("reading gzip response failed: %w", err)
+	}
+	return &readCloser{Reader: gz, closers: []io.Closer{gz, resp.Body}}, nil
+}
+
+// openZippedText reads zip archive and opens text file stored in it, the archive is buffered in its compressed form
+// and decompressed while the text is read
+func openZippedText(archive io.Reader) (io.ReadCloser, error) {
+	compressed, err := ioutil.ReadAll(io.LimitReader(archive, maxZipSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading zip archive failed: %w", err)
+	}
+	if len(compressed) > maxZipSize {
+		return nil, fmt.Errorf("zip archive exceeds %d bytes", maxZipSize)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		return nil, fmt.Errorf("reading zip archive failed: %w", err)
+	}
+
+	var text *zip.File
+	for _, f := range r.File {
+		if strings.EqualFold(path.Ext(f.Name), ".txt") {
+			text = f
+			break
+		}
+	}
+	if text == nil {
+		return nil, errors.New("zip archive contains no text file")
+	}
+	return text.Open()
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipLinkref(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected string
+		ok       bool
+	}
+
+	testCases := []testCase{
+		{input: "/files/1513/1513-0.txt", expected: "/files/1513/1513-0.zip", ok: true},
+		{input: "/1/5/1/1513/1513.txt", expected: "/1/5/1/1513/1513.zip", ok: true},
+		{input: "/cache/epub/1513/pg1513.txt", ok: false},
+		{input: "/ebooks/1513.txt.utf-8", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.input), func(t *testing.T) {
+			linkref, ok := zipLinkref(tc.input)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, linkref)
+		})
+	}
+}
+
+func zipped(t *testing.T, name, content string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create(name)
+	if err != nil {
+		t.Fatal("Failed to create zip entry: ", err)
+	}
+	_, _ = f.Write([]byte(content))
+	if err := w.Close(); err != nil {
+		t.Fatal("Failed to write zip archive: ", err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenTextCompressed(t *testing.T) {
+	archive := zipped(t, "1513-0.txt", "Romeo and Juliet")
+
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		switch r.URL.Path {
+		case "/files/1513/1513-0.zip":
+			_, _ = w.Write(archive)
+		case "/files/84/84-0.zip":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/files/84/84-0.txt":
+			_, _ = w.Write([]byte("Frankenstein"))
+		case "/files/1112/1112.txt":
+			assert.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write([]byte("The Tragedy of Romeo and Juliet"))
+			_ = gz.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := newTestProvider(t, []string{server.URL}, nil)
+	provider.compression = true
+
+	type testCase struct {
+		linkref   string
+		expected  string
+		requested []string
+	}
+
+	testCases := []testCase{
+		{
+			linkref:   "/files/1513/1513-0.txt",
+			expected:  "Romeo and Juliet",
+			requested: []string{"/files/1513/1513-0.zip"},
+		}, {
+			linkref:   "/files/1112/1112.txt",
+			expected:  "The Tragedy of Romeo and Juliet",
+			requested: []string{"/files/1112/1112.zip", "/files/1112/1112.txt"},
+		}, {
+			linkref:   "/files/84/84-0.txt",
+			expected:  "Frankenstein",
+			requested: []string{"/files/84/84-0.zip", "/files/84/84-0.txt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.linkref), func(t *testing.T) {
+			requested = nil
+			body, _, err := provider.openText(provider.sites, tc.linkref, Validators{})
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer body.Close()
+
+			content, err := ioutil.ReadAll(body)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, string(content))
+			assert.Equal(t, tc.requested, requested)
+		})
+	}
+}
+
+func TestOpenTextFallbackUnconditional(t *testing.T) {
+	lastModified := "Thu, 01 Oct 2020 12:00:00 GMT"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files/1513/1513-0.zip":
+			w.Header().Set("Last-Modified", lastModified)
+			_, _ = w.Write([]byte("damaged archive"))
+		case "/files/1513/1513-0.txt":
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", lastModified)
+			_, _ = w.Write([]byte("Romeo and Juliet"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := newTestProvider(t, []string{server.URL}, nil)
+	provider.compression = true
+
+	// validators of previously fetched zip do not apply to plain text
+	zipped := Validators{LastModified: lastModified, Source: server.URL + "/files/1513/1513-0.zip"}
+	body, validators, err := provider.openText(provider.sites, "/files/1513/1513-0.txt", zipped)
+	if assert.Nil(t, err) {
+		content, err := ioutil.ReadAll(body)
+		body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, "Romeo and Juliet", string(content))
+		assert.Equal(t, server.URL+"/files/1513/1513-0.txt", validators.Source)
+	}
+
+	// validators of plain text still make its request conditional
+	_, _, err = provider.openText(provider.sites, "/files/1513/1513-0.txt", validators)
+	assert.Equal(t, ErrNotModified, err)
+}
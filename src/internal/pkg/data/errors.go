@@ -0,0 +1,88 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is returned when upstream responds with unexpected status code
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // delay requested with Retry-After header, 0 if not requested
+}
+
+func (e *StatusError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("unexpected status code: %d (retry after %s)", e.StatusCode, e.RetryAfter)
+	}
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// PartialError is returned together with books listed by providers which succeeded when some of the others failed,
+// such listing is usable but incomplete
+type PartialError struct {
+	Err error // failure of the last failed provider
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("listing is partial: %s", e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// newStatusError describes failed response, its Retry-After header is given either in seconds or as HTTP date
+func newStatusError(resp *http.Response, now time.Time) *StatusError {
+	err := &StatusError{StatusCode: resp.StatusCode}
+
+	retryAfter := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if seconds, parseErr := strconv.Atoi(retryAfter); parseErr == nil && seconds > 0 {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	} else if date, parseErr := http.ParseTime(retryAfter); parseErr == nil && date.After(now) {
+		err.RetryAfter = date.Sub(now)
+	}
+	return err
+}
+
+// IsPermanent tells whether failure of provider's operation is permanent, so retrying it does not make sense:
+// book or its text is missing, page cannot be parsed, request is refused by upstream or disallowed by its
+// robots.txt. Failed connections, throttling and server errors are transient.
+func IsPermanent(err error) bool {
+	if errors.Is(err, errNotFound) || errors.Is(err, ErrTxtLinkRefNotAvailable) {
+		return true
+	}
+
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return true
+	}
+
+	var disallowed *DisallowedError
+	if errors.As(err, &disallowed) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return false
+		}
+		return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
+	}
+	return false
+}
+
+// RetryAfter returns delay requested by upstream before failed operation is retried
+func RetryAfter(err error) (time.Duration, bool) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter, true
+	}
+	return 0, false
+}
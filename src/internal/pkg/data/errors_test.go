@@ -0,0 +1,65 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPermanent(t *testing.T) {
+	type testCase struct {
+		err      error
+		expected bool
+	}
+
+	testCases := []testCase{
+		{err: fmt.Errorf("/ebooks/0: %w", errNotFound), expected: true},
+		{err: fmt.Errorf("finding txt linkref failed: %w", &errNoLinkRef{}), expected: true},
+		{err: &ParseError{Page: "book", Reason: "no book entries found"}, expected: true},
+		{err: &StatusError{StatusCode: http.StatusForbidden}, expected: true},
+		{err: &StatusError{StatusCode: http.StatusTooManyRequests}, expected: false},
+		{err: &StatusError{StatusCode: http.StatusServiceUnavailable}, expected: false},
+		{err: fmt.Errorf("request failed: %w", errors.New("connection reset by peer")), expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.err), func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsPermanent(tc.err))
+		})
+	}
+}
+
+func TestNewStatusError(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	type testCase struct {
+		retryAfter string
+		expected   time.Duration
+	}
+
+	testCases := []testCase{
+		{retryAfter: "", expected: 0},
+		{retryAfter: "120", expected: time.Minute * 2},
+		{retryAfter: "Thu, 01 Oct 2020 12:00:30 GMT", expected: time.Second * 30},
+		{retryAfter: "Thu, 01 Oct 2020 11:00:00 GMT", expected: 0},
+		{retryAfter: "soon", expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.retryAfter), func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			resp.Header.Set("Retry-After", tc.retryAfter)
+
+			err := newStatusError(resp, now)
+			assert.Equal(t, tc.expected, err.RetryAfter)
+
+			retryAfter, ok := RetryAfter(fmt.Errorf("downloading failed: %w", err))
+			assert.Equal(t, tc.expected, retryAfter)
+			assert.Equal(t, tc.expected > 0, ok)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// MIME types of book editions content can be read from
+const (
+	editionText = "text/plain"
+	editionHTML = "text/html"
+	editionEPUB = "application/epub+zip"
+)
+
+// blockElements separate paragraphs of extracted text
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Blockquote: true, atom.Pre: true, atom.Hr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Table: true, atom.Tr: true, atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true,
+}
+
+// skippedElements do not contain readable text
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+}
+
+// textExtractor collects paragraphs of HTML document, paragraphs are separated by an empty line and lines broken
+// with <br> are kept, so verses and chapter headings stay on their own lines
+type textExtractor struct {
+	paragraphs []string
+	current    strings.Builder
+}
+
+func (e *textExtractor) flush() {
+	var lines []string
+	for _, line := range strings.Split(e.current.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 0 {
+		e.paragraphs = append(e.paragraphs, strings.Join(lines, "\n"))
+	}
+	e.current.Reset()
+}
+
+func (e *textExtractor) walk(n *html.Node, pre bool) {
+	switch n.Type {
+	case html.TextNode:
+		if pre {
+			e.current.WriteString(n.Data)
+		} else {
+			// line breaks of the source are not meaningful outside of <pre>
+			e.current.WriteString(strings.ReplaceAll(n.Data, "\n", " "))
+		}
+		return
+	case html.ElementNode:
+		if skippedElements[n.DataAtom] {
+			return
+		}
+		if n.DataAtom == atom.Br {
+			e.current.WriteByte('\n')
+			return
+		}
+		pre = pre || n.DataAtom == atom.Pre
+	}
+
+	block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+	if block {
+		e.flush()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		e.walk(c, pre)
+	}
+	if block {
+		e.flush()
+	}
+}
+
+// htmlText extracts readable text of HTML document
+func htmlText(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", fmt.Errorf("parsing html failed: %w", err)
+	}
+	var e textExtractor
+	e.walk(doc, false)
+	e.flush()
+	return strings.Join(e.paragraphs, "\n\n"), nil
+}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// epubText extracts readable text of EPUB archive, documents are read in reading order given by the spine
+func epubText(archive []byte) (string, error) {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return "", fmt.Errorf("reading epub archive failed: %w", err)
+	}
+	files := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	var container epubContainer
+	if err := readXML(files, "META-INF/container.xml", &container); err != nil {
+		return "", err
+	}
+	if len(container.Rootfiles) == 0 {
+		return "", errors.New("epub container lists no package")
+	}
+	packagePath := container.Rootfiles[0].FullPath
+
+	var pkg epubPackage
+	if err := readXML(files, packagePath, &pkg); err != nil {
+		return "", err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		if item.MediaType == "application/xhtml+xml" || item.MediaType == editionHTML {
+			hrefs[item.ID] = item.Href
+		}
+	}
+
+	var documents []string
+	for _, itemref := range pkg.Spine {
+		href, ok := hrefs[itemref.IDRef]
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		f, ok := files[path.Join(path.Dir(packagePath), href)]
+		if !ok {
+			return "", fmt.Errorf("epub document '%s' is missing", href)
+		}
+
+		content, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("reading epub document '%s' failed: %w", href, err)
+		}
+		text, err := htmlText(content)
+		content.Close()
+		if err != nil {
+			return "", err
+		}
+		if text != "" {
+			documents = append(documents, text)
+		}
+	}
+
+	if len(documents) == 0 {
+		return "", errors.New("epub contains no readable documents")
+	}
+	return strings.Join(documents, "\n\n"), nil
+}
+
+func readXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("epub file '%s' is missing", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("reading epub file '%s' failed: %w", name, err)
+	}
+	defer r.Close()
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("reading epub file '%s' failed: %w", name, err)
+	}
+	if err := xml.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("parsing epub file '%s' failed: %w", name, err)
+	}
+	return nil
+}
+
+// extractText reads book edition of given MIME type and extracts its readable text
+func extractText(r io.Reader, mimeType string) (string, error) {
+	switch mimeType {
+	case editionHTML:
+		return htmlText(r)
+	case editionEPUB:
+		archive, err := ioutil.ReadAll(io.LimitReader(r, maxZipSize+1))
+		if err != nil {
+			return "", fmt.Errorf("reading epub archive failed: %w", err)
+		}
+		if len(archive) > maxZipSize {
+			return "", fmt.Errorf("epub archive exceeds %d bytes", maxZipSize)
+		}
+		return epubText(archive)
+	default:
+		return "", fmt.Errorf("text cannot be extracted from '%s' edition", mimeType)
+	}
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHtmlText(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected string
+	}
+
+	testCases := []testCase{
+		{
+			input:    "<p>Two households, both alike\n  in dignity,</p><p>In fair <i>Verona</i>, where we lay our scene,</p>",
+			expected: "Two households, both alike in dignity,\n\nIn fair Verona, where we lay our scene,",
+		}, {
+			input: `<html><head><title>Romeo and Juliet</title><style>p { margin: 0 }</style></head>
+<body><h2>ACT II</h2><h3>SCENE II. Capulet’s Garden.</h3>
+<p class="verse">O Romeo, Romeo,<br/>wherefore art thou Romeo?</p><script>track()</script></body></html>`,
+			expected: "ACT II\n\nSCENE II. Capulet’s Garden.\n\nO Romeo, Romeo,\nwherefore art thou Romeo?",
+		}, {
+			input:    "<div>Ro<b>meo</b><div>Juliet</div></div><pre>  NURSE.\n  Anon, anon!</pre>",
+			expected: "Romeo\n\nJuliet\n\nNURSE.\nAnon, anon!",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.input), func(t *testing.T) {
+			text, err := htmlText(strings.NewReader(tc.input))
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, text)
+		})
+	}
+}
+
+func testEpub(t *testing.T, files [][2]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := w.Create(file[0])
+		if err != nil {
+			t.Fatal("Failed to create epub entry: ", err)
+		}
+		_, _ = f.Write([]byte(file[1]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("Failed to write epub archive: ", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEpubText(t *testing.T) {
+	container := [2]string{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`}
+	opf := [2]string{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+<manifest>
+<item id="chapter" href="chapter%201.xhtml" media-type="application/xhtml+xml"/>
+<item id="title" href="title.xhtml" media-type="application/xhtml+xml"/>
+<item id="css" href="style.css" media-type="text/css"/>
+</manifest>
+<spine><itemref idref="title"/><itemref idref="css"/><itemref idref="chapter"/></spine>
+</package>`}
+	title := [2]string{"OEBPS/title.xhtml", `<html><body><h1>ROMEO AND JULIET</h1></body></html>`}
+	chapter := [2]string{"OEBPS/chapter 1.xhtml",
+		`<html><body><h2>PROLOGUE</h2><p>Two households, both alike in dignity,</p></body></html>`}
+
+	text, err := epubText(testEpub(t, [][2]string{{"mimetype", editionEPUB}, container, opf, chapter, title}))
+	assert.Nil(t, err)
+	assert.Equal(t, "ROMEO AND JULIET\n\nPROLOGUE\n\nTwo households, both alike in dignity,", text)
+
+	_, err = epubText(testEpub(t, [][2]string{opf, chapter, title}))
+	assert.NotNil(t, err)
+
+	_, err = epubText(testEpub(t, [][2]string{container, opf, title}))
+	assert.NotNil(t, err)
+}
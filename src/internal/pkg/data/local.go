@@ -0,0 +1,242 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxHeaderLines limits number of lines read from a book file looking for its Gutenberg header
+const maxHeaderLines = 300
+
+var (
+	localFileName = regexp.MustCompile(`^(?:pg)?(\d+)(-0|-8)?\.txt$`)
+	headerEbookID = regexp.MustCompile(`(?i)\[e-?book #(\d+)\]`)
+)
+
+// languageNames maps language codes used in queries to language names of Gutenberg headers
+var languageNames = map[string]string{
+	"da": "Danish",
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fi": "Finnish",
+	"fr": "French",
+	"it": "Italian",
+	"la": "Latin",
+	"nl": "Dutch",
+	"pt": "Portuguese",
+	"sv": "Swedish",
+}
+
+type localBook struct {
+	Book
+	path string
+	rank int // preference of the file among editions of the same ebook, lower is better
+}
+
+// localProvider serves books from plain text files of a local directory, either a flat collection of downloaded
+// books or an offline copy of Gutenberg file tree. Book metadata are read from Gutenberg headers of the files.
+type localProvider struct {
+	books []localBook
+	index map[string]int // book ID to position in books
+}
+
+// NewLocalProvider indexes text files of given directory (including subdirectories)
+func NewLocalProvider(dir string) (Provider, error) {
+	p := &localProvider{index: map[string]int{}}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".txt") {
+			return nil
+		}
+
+		book, err := readLocalBook(dir, path)
+		if err != nil {
+			return err
+		}
+		if i, ok := p.index[book.ID()]; ok {
+			if book.rank < p.books[i].rank {
+				p.books[i] = book
+			}
+			return nil
+		}
+		p.index[book.ID()] = len(p.books)
+		p.books = append(p.books, book)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("indexing local books in %s failed: %w", dir, err)
+	}
+	return p, nil
+}
+
+// readLocalBook reads metadata of a book file, ebook ID is taken from the header or the file name, books without
+// it are identified by their path, eg. "/local/shakespeare/hamlet.txt"
+func readLocalBook(dir, path string) (localBook, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return localBook{}, err
+	}
+	defer f.Close()
+
+	book := localBook{path: path, rank: 1}
+	id := 0
+	if match := localFileName.FindStringSubmatch(filepath.Base(path)); match != nil {
+		id, _ = strconv.Atoi(match[1])
+		// editions are preferred in the same order as on file mirrors: UTF-8, ASCII, then Latin-1
+		switch match[2] {
+		case "-0":
+			book.rank = 0
+		case "-8":
+			book.rank = 2
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < maxHeaderLines && scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "*** START OF") {
+			break
+		}
+		if match := headerEbookID.FindStringSubmatch(line); match != nil && id == 0 {
+			id, _ = strconv.Atoi(match[1])
+		}
+
+		sep := strings.IndexByte(line, ':')
+		if sep < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[sep+1:])
+		switch strings.ToLower(line[:sep]) {
+		case "title":
+			book.Title = value
+		case "author":
+			book.Author = value
+		case "language":
+			book.Language = value
+		case "release date":
+			book.ReleaseDate = strings.TrimSpace(headerEbookID.ReplaceAllString(value, ""))
+		}
+	}
+	// lines longer than the scanner buffer end the header
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return localBook{}, err
+	}
+
+	if id > 0 {
+		book.bookLinkref = fmt.Sprintf("/ebooks/%d", id)
+	} else {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return localBook{}, err
+		}
+		book.bookLinkref = "/local/" + filepath.ToSlash(rel)
+	}
+	if book.Title == "" {
+		book.Title = strings.TrimSuffix(filepath.Base(path), ".txt")
+	}
+	return book, nil
+}
+
+// GetBooks lists indexed books matching the query, sorted by title. Bookshelves are not known locally.
+func (p *localProvider) GetBooks(query BookQuery) ([]Book, error) {
+	books := []Book{}
+	if len(query.IDs) > 0 {
+		for _, id := range query.IDs {
+			if i, ok := p.index[fmt.Sprintf("/ebooks/%d", id)]; ok {
+				books = append(books, p.books[i].Book)
+			}
+		}
+		return books, nil
+	}
+	if query.Bookshelf != 0 {
+		return books, nil
+	}
+
+	for _, book := range p.books {
+		if localMatches(query, book.Book) {
+			books = append(books, book.Book)
+		}
+	}
+	sort.SliceStable(books, func(i, j int) bool {
+		return books[i].Title < books[j].Title
+	})
+	return books, nil
+}
+
+// localMatches tells whether every word of query criteria is found in corresponding book metadata
+func localMatches(query BookQuery, book Book) bool {
+	if query.Language != "" {
+		name, ok := languageNames[query.Language]
+		if !ok || !strings.EqualFold(name, book.Language) {
+			return false
+		}
+	}
+
+	for _, field := range []struct{ query, value string }{
+		{query.Title, book.Title},
+		{query.Author, book.Author},
+		{query.Subject, strings.Join(book.Subjects, " ")},
+	} {
+		for _, word := range strings.Fields(field.query) {
+			if !containsFold(field.value, word) {
+				return false
+			}
+		}
+	}
+	return query.matches(book)
+}
+
+func (p *localProvider) find(book Book) (localBook, error) {
+	i, ok := p.index[book.ID()]
+	if !ok {
+		return localBook{}, fmt.Errorf("%s: %w", book.ID(), errNotFound)
+	}
+	return p.books[i], nil
+}
+
+// DownloadBook reads text of the book file
+func (p *localProvider) DownloadBook(book Book) (string, error) {
+	local, err := p.find(book)
+	if err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadFile(local.path)
+	if err != nil {
+		return "", fmt.Errorf("reading %s failed: %w", local.path, err)
+	}
+	return string(content), nil
+}
+
+// OpenBook opens the book file for reading
+func (p *localProvider) OpenBook(book Book) (io.ReadCloser, error) {
+	local, err := p.find(book)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(local.path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s failed: %w", local.path, err)
+	}
+	return file, nil
+}
+
+// BookDetails returns metadata read from the book header
+func (p *localProvider) BookDetails(book Book) (Book, error) {
+	local, err := p.find(book)
+	if err != nil {
+		return Book{}, err
+	}
+	return book.withDetails(local.Book), nil
+}
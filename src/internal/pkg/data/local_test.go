@@ -0,0 +1,97 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLocalBooks(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "local-books")
+	if err != nil {
+		t.Fatal("Failed to create books directory: ", err)
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal("Failed to create books directory: ", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal("Failed to write book: ", err)
+		}
+	}
+	return root
+}
+
+func TestLocalProvider(t *testing.T) {
+	root := writeLocalBooks(t, map[string]string{
+		"1/5/1/1513/1513-0.txt": "Title: Romeo and Juliet\nAuthor: William Shakespeare\n" +
+			"Release Date: November, 1998 [EBook #1513]\nLanguage: English\n\n" +
+			"*** START OF THIS PROJECT GUTENBERG EBOOK ROMEO AND JULIET ***\nTitle: Act I",
+		"1/5/1/1513/1513-8.txt": "Title: Romeo and Juliet (Latin-1)\n",
+		"hamlet.txt":            "The Project Gutenberg eBook of Hamlet [eBook #1524]\n\nTitle: Hamlet\nAuthor: William Shakespeare\n",
+		"notes/faust.txt":       "Title: Faust\nAuthor: Johann Wolfgang von Goethe\nLanguage: German\n",
+		"readme.md":             "Title: not a book",
+	})
+	defer os.RemoveAll(root)
+
+	provider, err := NewLocalProvider(root)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	type testCase struct {
+		query    BookQuery
+		expected []string
+	}
+
+	testCases := []testCase{
+		{query: BookQuery{Title: "romeo"}, expected: []string{"/ebooks/1513"}},
+		{query: BookQuery{Author: "shakespeare"}, expected: []string{"/ebooks/1524", "/ebooks/1513"}},
+		{query: BookQuery{Author: "goethe", Language: "de"}, expected: []string{"/local/notes/faust.txt"}},
+		{query: BookQuery{Author: "goethe", Language: "en"}, expected: []string{}},
+		{query: BookQuery{Author: "shakespeare", MaxID: 1520}, expected: []string{"/ebooks/1513"}},
+		{query: BookQuery{IDs: []int{1524, 1}}, expected: []string{"/ebooks/1524"}},
+		{query: BookQuery{Bookshelf: 1}, expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.query), func(t *testing.T) {
+			books, err := provider.GetBooks(tc.query)
+			assert.Nil(t, err)
+			ids := []string{}
+			for _, book := range books {
+				ids = append(ids, book.ID())
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+
+	romeo, _ := NewBook("", "", "/ebooks/1513")
+	content, err := provider.DownloadBook(romeo)
+	assert.Nil(t, err)
+	assert.Contains(t, content, "*** START OF")
+
+	body, err := provider.(BookOpener).OpenBook(romeo)
+	if assert.Nil(t, err) {
+		streamed, _ := ioutil.ReadAll(body)
+		body.Close()
+		assert.Equal(t, content, string(streamed))
+	}
+
+	details, err := provider.BookDetails(romeo)
+	assert.Nil(t, err)
+	assert.Equal(t, "Romeo and Juliet", details.Title)
+	assert.Equal(t, "November, 1998", details.ReleaseDate)
+
+	missing, _ := NewBook("", "", "/ebooks/2")
+	_, err = provider.DownloadBook(missing)
+	assert.True(t, errors.Is(err, errNotFound))
+	_, err = provider.(BookOpener).OpenBook(missing)
+	assert.True(t, errors.Is(err, errNotFound))
+}
@@ -0,0 +1,168 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultMirror = "https://www.gutenberg.org"
+
+const (
+	mirrorBackoffMin = time.Second * 30 // unhealthy mirror is skipped for this long after its first failure
+	mirrorBackoffMax = time.Minute * 10 // upper bound of the skip period doubled with every consecutive failure
+)
+
+// errNotFound is returned when requested file does not exist on any of the mirrors
+var errNotFound = errors.New("not found on any mirror")
+
+// mirror is a single source of Gutenberg content. Site mirrors serve the whole website (search, book pages and
+// files), file mirrors serve only the file tree as distributed by rsync, eg. "1/5/1/1513/1513-0.txt".
+type mirror struct {
+	url *url.URL
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	skipUntil           time.Time
+
+	crawl crawlPolicy
+}
+
+func newMirror(rawUrl string, files bool) (*mirror, error) {
+	u, err := url.Parse(strings.TrimSuffix(rawUrl, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror url '%s': %w", rawUrl, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid mirror url '%s': host is missing", rawUrl)
+		}
+	case "file":
+		if !files {
+			return nil, fmt.Errorf("invalid mirror url '%s': local mirror can serve files only", rawUrl)
+		}
+	default:
+		return nil, fmt.Errorf("invalid mirror url '%s': unsupported scheme '%s'", rawUrl, u.Scheme)
+	}
+	return &mirror{url: u}, nil
+}
+
+func (m *mirror) String() string {
+	return m.url.String()
+}
+
+// urlOf returns absolute url of given linkref on the mirror
+func (m *mirror) urlOf(linkref string) string {
+	if !strings.HasPrefix(linkref, "/") {
+		linkref = "/" + linkref
+	}
+	return m.url.String() + linkref
+}
+
+func (m *mirror) healthy(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !now.Before(m.skipUntil)
+}
+
+func (m *mirror) retryAt() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.skipUntil
+}
+
+// markSuccess restores health of the mirror
+func (m *mirror) markSuccess() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.consecutiveFailures > 0 {
+		log.Printf("Mirror %s is healthy again", m)
+	}
+	m.consecutiveFailures = 0
+	m.skipUntil = time.Time{}
+}
+
+// markFailure makes the mirror skipped for a period growing with every consecutive failure, or for the period
+// requested by the mirror itself if it is longer
+func (m *mirror) markFailure(cause error, retryAfter time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consecutiveFailures++
+
+	backoff := mirrorBackoffMin
+	for i := 1; i < m.consecutiveFailures && backoff < mirrorBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > mirrorBackoffMax {
+		backoff = mirrorBackoffMax
+	}
+	if retryAfter > backoff {
+		backoff = retryAfter
+	}
+	m.skipUntil = time.Now().Add(backoff)
+	log.Printf("Mirror %s failed (%d in a row), skipping it for %s: %s", m, m.consecutiveFailures, backoff, cause)
+}
+
+// byHealth returns mirrors in order they should be tried: healthy ones in configured order, followed by unhealthy
+// ones ordered by end of their skip period, so there is always a mirror to try
+func byHealth(mirrors []*mirror) []*mirror {
+	now := time.Now()
+	var healthy, unhealthy []*mirror
+	for _, m := range mirrors {
+		if m.healthy(now) {
+			healthy = append(healthy, m)
+		} else {
+			unhealthy = append(unhealthy, m)
+		}
+	}
+	sort.SliceStable(unhealthy, func(i, j int) bool { return unhealthy[i].retryAt().Before(unhealthy[j].retryAt()) })
+	return append(healthy, unhealthy...)
+}
+
+// failing tells whether response status means mirror is unable to serve requests at the moment (eg. throttling),
+// as opposed to missing file which is not a mirror failure
+func failing(statusCode int) bool {
+	switch statusCode {
+	case http.StatusOK, http.StatusNotModified, http.StatusNotFound, http.StatusGone:
+		return false
+	default:
+		return true
+	}
+}
+
+// fileTreeDir returns directory of the ebook in Gutenberg file tree, every digit but the last one forms a level of
+// directories, eg. "1/5/1/1513" for 1513 or "0/5" for 5
+func fileTreeDir(id int) string {
+	digits := strconv.Itoa(id)
+	if len(digits) == 1 {
+		return "0/" + digits
+	}
+	return strings.Join(strings.Split(digits[:len(digits)-1], ""), "/") + "/" + digits
+}
+
+// fileTreeEditions returns candidate editions of the ebook in Gutenberg file tree, plain text editions go first
+// starting with UTF-8 one, HTML edition is the last resort
+func fileTreeEditions(id int) []edition {
+	dir := fileTreeDir(id)
+	return []edition{
+		{linkref: fmt.Sprintf("/%s/%d-0.txt", dir, id), mimeType: editionText},
+		{linkref: fmt.Sprintf("/%s/%d.txt", dir, id), mimeType: editionText},
+		{linkref: fmt.Sprintf("/%s/%d-8.txt", dir, id), mimeType: editionText},
+		{linkref: fmt.Sprintf("/%s/%d-h/%d-h.htm", dir, id, id), mimeType: editionHTML},
+	}
+}
+
+// newTransport returns http transport able to serve file:// urls of local mirrors as well
+func newTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return transport
+}
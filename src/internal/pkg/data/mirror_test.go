@@ -0,0 +1,115 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProvider(t *testing.T, sites, files []string) *httpProvider {
+	provider, err := NewProvider(ProviderConfig{Timeout: time.Second, Mirrors: sites, FileMirrors: files})
+	if err != nil {
+		t.Fatal("Failed to create provider: ", err)
+	}
+	return provider.(*httpProvider)
+}
+
+func TestFileTreeDir(t *testing.T) {
+	testCases := map[int]string{
+		5:     "0/5",
+		12:    "1/12",
+		1513:  "1/5/1/1513",
+		47960: "4/7/9/6/47960",
+	}
+
+	for id, expected := range testCases {
+		t.Run(fmt.Sprintf("input:'%d'", id), func(t *testing.T) {
+			assert.Equal(t, expected, fileTreeDir(id))
+		})
+	}
+}
+
+func TestNewProviderInvalidMirror(t *testing.T) {
+	for _, cfg := range []ProviderConfig{
+		{Mirrors: []string{"ftp://gutenberg.org"}},
+		{Mirrors: []string{"file:///srv/gutenberg"}},
+		{FileMirrors: []string{"http://"}},
+	} {
+		t.Run(fmt.Sprintf("input:'%v'", cfg), func(t *testing.T) {
+			_, err := NewProvider(cfg)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestFetchFailover(t *testing.T) {
+	var throttledHits int
+	throttled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		throttledHits++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer throttled.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer healthy.Close()
+
+	provider := newTestProvider(t, []string{throttled.URL, healthy.URL}, nil)
+
+	for _, linkref := range []string{"/ebooks/1513", "/ebooks/1112"} {
+		body, err := provider.getPage(linkref)
+		assert.Nil(t, err)
+		assert.Equal(t, linkref, body)
+	}
+	// throttling mirror is skipped after its first failure
+	assert.Equal(t, 1, throttledHits)
+	assert.Equal(t, []*mirror{provider.sites[1], provider.sites[0]}, byHealth(provider.sites))
+}
+
+func TestFetchNotFound(t *testing.T) {
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	provider := newTestProvider(t, []string{missing.URL, missing.URL + "/"}, nil)
+
+	_, err := provider.getPage("/ebooks/99999999")
+	assert.True(t, errors.Is(err, errNotFound))
+	// missing page is not a failure of the mirror
+	assert.Equal(t, provider.sites, byHealth(provider.sites))
+}
+
+func TestOpenBookFromFileMirror(t *testing.T) {
+	root, err := ioutil.TempDir("", "gutenberg-mirror")
+	if err != nil {
+		t.Fatal("Failed to create mirror directory: ", err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "1", "5", "1", "1513")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal("Failed to create mirror directory: ", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "1513.txt"), []byte("Romeo and Juliet"), 0644); err != nil {
+		t.Fatal("Failed to write mirrored book: ", err)
+	}
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to site mirror: %s", r.URL)
+	}))
+	defer site.Close()
+
+	provider := newTestProvider(t, []string{site.URL}, []string{"file://" + filepath.ToSlash(root)})
+	book, _ := NewBook("Romeo and Juliet", "", "/ebooks/1513")
+
+	content, err := provider.DownloadBook(book)
+	assert.Nil(t, err)
+	assert.Equal(t, "Romeo and Juliet", content)
+}
@@ -1,72 +1,296 @@
 package data
 
 import (
-	"errors"
-	"regexp"
-)
+	"fmt"
+	"strconv"
+	"strings"
 
-var (
-	findBooksRegexStage1 = regexp.MustCompile("(?s)<li class=\"booklink\">.*?</li>")
-	findBooksRegexStage2 = regexp.MustCompile(
-		"(?s)" + // flag includes newline character into the scope of dot (.)
-			"<li class=\"booklink\">.*?" +
-			"<a class=\"link\" href=\"(?P<linkref>.*?)\".*?" + // group 1
-			"<span class=\"title\">(?P<title>.*?)</span>.*?" + // group 2
-			"<span class=\"subtitle\">(?P<subtitle>.*?)</span>.*?" + // group 3
-			"</li>",
-	)
-	findTxtLinkrefRegexStage1 = regexp.MustCompile("(?s)<a href.+?</a>")
-	findTxtLinkrefRegexStage2 = regexp.MustCompile(
-		"(?s)" +
-			"<a href=\"(?P<txtlinkref>\\S*?)\".*?" + // group 1
-			"title=\"Download\">Plain Text.*?" +
-			"</a>",
-	)
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
-// findBooks parses book search query
-func findBooks(responseBody string) ([]Book, error) {
+// ParseError describes page which could not be parsed as expected, eg. due to markup changes
+type ParseError struct {
+	Page   string // kind of parsed page, eg. "search results"
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parsing %s page failed: %s", e.Page, e.Reason)
+}
+
+func parseDocument(page, responseBody string) (*html.Node, error) {
+	doc, err := html.Parse(strings.NewReader(responseBody))
+	if err != nil {
+		return nil, &ParseError{Page: page, Reason: err.Error()}
+	}
+	return doc, nil
+}
+
+// findAll returns all descendants of n (including n) accepted by match, in document order
+func findAll(n *html.Node, match func(n *html.Node) bool) []*html.Node {
+	var found []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if match(n) {
+			found = append(found, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// findFirst returns first descendant of n accepted by match, nil if there is none
+func findFirst(n *html.Node, match func(n *html.Node) bool) *html.Node {
+	if match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findFirst(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// element returns selector of elements with given tag and class, empty class matches any element of given tag
+func element(tag atom.Atom, class string) func(n *html.Node) bool {
+	return func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.DataAtom == tag && (class == "" || hasClass(n, class))
+	}
+}
+
+// withClass returns selector of elements of any tag with given class
+func withClass(class string) func(n *html.Node) bool {
+	return func(n *html.Node) bool {
+		return n.Type == html.ElementNode && hasClass(n, class)
+	}
+}
+
+// text returns text content of n with collapsed whitespaces
+func text(n *html.Node) string {
+	var b strings.Builder
+	for _, t := range findAll(n, func(n *html.Node) bool { return n.Type == html.TextNode }) {
+		b.WriteString(t.Data)
+		b.WriteByte(' ')
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// leadingInt returns first number found in s, eg. 224 for "224 downloads"
+func leadingInt(s string) int {
+	for _, field := range strings.Fields(s) {
+		if value, err := strconv.Atoi(strings.ReplaceAll(field, ",", "")); err == nil {
+			return value
+		}
+	}
+	return 0
+}
+
+// coverURL returns source of the first image with given class, eg. "cover-thumb" of listing entries
+func coverURL(n *html.Node, class string) string {
+	cover := findFirst(n, element(atom.Img, class))
+	if cover == nil {
+		return ""
+	}
+	return attr(cover, "src")
+}
+
+// findBooks parses book search query (or bookshelf) results, entries without title or link are skipped
+func findBooks(doc *html.Node) ([]Book, error) {
 	var books []Book
 
-	matches := findBooksRegexStage1.FindAllString(responseBody, -1)
-	if len(matches) == 0 {
-		return books, errors.New("no results")
+	entries := findAll(doc, element(atom.Li, "booklink"))
+	if len(entries) == 0 && noResults(doc) {
+		return books, nil
+	}
+	if len(entries) == 0 {
+		return books, &ParseError{Page: "search results", Reason: "no book entries found"}
 	}
 
-	for _, stage2 := range matches {
-		match := findBooksRegexStage2.FindStringSubmatch(stage2)
-		if match == nil {
+	for _, entry := range entries {
+		link := findFirst(entry, func(n *html.Node) bool {
+			return element(atom.A, "")(n) && attr(n, "href") != ""
+		})
+		title := findFirst(entry, withClass("title"))
+		if link == nil || title == nil {
 			continue
 		}
 
-		title := match[2]
-		author := match[3]
-		linkref := match[1]
+		var author string
+		if subtitle := findFirst(entry, withClass("subtitle")); subtitle != nil {
+			author = text(subtitle)
+		}
 
-		book, err := NewBook(title, author, linkref)
+		book, err := NewBook(text(title), author, attr(link, "href"))
 		if err != nil {
 			continue
 		}
+		if extra := findFirst(entry, withClass("extra")); extra != nil {
+			book.Downloads = leadingInt(text(extra))
+		}
+		book.CoverURL = coverURL(entry, "cover-thumb")
 		books = append(books, book)
 	}
 
+	if len(books) == 0 {
+		return books, &ParseError{
+			Page:   "search results",
+			Reason: fmt.Sprintf("none of %d book entries could be parsed", len(entries)),
+		}
+	}
 	return books, nil
 }
 
-// findTxtLinkref parses book entry page
-func findTxtLinkref(responseBody string) (string, error) {
-	matches := findTxtLinkrefRegexStage1.FindAllString(responseBody, -1)
-	if len(matches) == 0 {
+// noResults tells whether search results page reports that nothing was found
+func noResults(doc *html.Node) bool {
+	for _, status := range findAll(doc, element(atom.Li, "statusline")) {
+		if strings.Contains(text(status), "No records found") {
+			return true
+		}
+	}
+	return false
+}
+
+// findNextPageLinkref parses search results page looking for a link to the next page of results
+func findNextPageLinkref(doc *html.Node) (string, bool) {
+	next := findFirst(doc, func(n *html.Node) bool {
+		if !element(atom.A, "")(n) || attr(n, "href") == "" {
+			return false
+		}
+		return attr(n, "rel") == "next" ||
+			strings.HasPrefix(attr(n, "title"), "Go to the next page") ||
+			text(n) == "Next"
+	})
+	if next == nil {
+		return "", false
+	}
+	return attr(next, "href"), true
+}
+
+// formatLinks returns download links of book page, these are links with MIME type of the file
+func formatLinks(doc *html.Node) []*html.Node {
+	return findAll(doc, func(n *html.Node) bool {
+		return element(atom.A, "")(n) && attr(n, "href") != "" && attr(n, "type") != ""
+	})
+}
+
+// findTxtLinkref parses book entry page, UTF-8 edition is preferred over other plain text editions
+func findTxtLinkref(doc *html.Node) (string, error) {
+	var linkref string
+	for _, link := range formatLinks(doc) {
+		mimeType := strings.ToLower(attr(link, "type"))
+		if !strings.HasPrefix(mimeType, "text/plain") {
+			continue
+		}
+		if strings.Contains(mimeType, "utf-8") {
+			return attr(link, "href"), nil
+		}
+		if linkref == "" {
+			linkref = attr(link, "href")
+		}
+	}
+
+	if linkref == "" {
 		return "", &errNoLinkRef{}
 	}
+	return linkref, nil
+}
+
+// findFallbackEdition parses book entry page looking for an edition text can be extracted from, when there is no
+// plain text edition. Generated HTML edition is preferred over EPUB, editions without images are preferred as well.
+// Other HTML files (eg. index of audio book files) are not considered to be editions of the book.
+func findFallbackEdition(doc *html.Node) (string, string, bool) {
+	var best, bestType string
+	bestRank := 0
+	for _, link := range formatLinks(doc) {
+		href := attr(link, "href")
+		mimeType := strings.ToLower(attr(link, "type"))
 
-	for _, stage2 := range matches {
-		matches := findTxtLinkrefRegexStage2.FindStringSubmatch(stage2)
-		if matches == nil {
+		var rank int
+		switch {
+		case strings.HasPrefix(mimeType, editionHTML) && (strings.HasPrefix(href, "/ebooks/") || strings.Contains(href, "-h/")):
+			rank, mimeType = 4, editionHTML
+		case strings.HasPrefix(mimeType, editionEPUB):
+			rank, mimeType = 2, editionEPUB
+		default:
 			continue
 		}
-		return matches[1], nil
+		if strings.HasSuffix(href, ".noimages") {
+			rank++
+		}
+
+		if rank > bestRank {
+			best, bestType, bestRank = href, mimeType, rank
+		}
+	}
+	return best, bestType, bestRank > 0
+}
+
+// findBookDetails parses book entry page metadata, fields missing on the page are left empty
+func findBookDetails(doc *html.Node) Book {
+	var book Book
+
+	if bibrec := findFirst(doc, element(atom.Table, "bibrec")); bibrec != nil {
+		for _, row := range findAll(bibrec, element(atom.Tr, "")) {
+			header := findFirst(row, element(atom.Th, ""))
+			cell := findFirst(row, element(atom.Td, ""))
+			if header == nil || cell == nil {
+				continue
+			}
+			value := text(cell)
+			if value == "" {
+				continue
+			}
+
+			switch text(header) {
+			case "Title":
+				book.Title = value
+			case "Author":
+				if book.Author == "" {
+					book.Author = value
+				}
+			case "Language":
+				book.Language = value
+			case "Subject":
+				book.Subjects = append(book.Subjects, value)
+			case "Release Date":
+				book.ReleaseDate = value
+			case "Downloads":
+				book.Downloads = leadingInt(value)
+			}
+		}
+	}
+
+	for _, link := range formatLinks(doc) {
+		book.Formats = append(book.Formats, Format{
+			Name: text(link),
+			Type: attr(link, "type"),
+			URL:  attr(link, "href"),
+		})
 	}
 
-	return "", &errNoLinkRef{}
+	book.CoverURL = coverURL(doc, "cover-art")
+	return book
 }
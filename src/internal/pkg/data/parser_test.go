@@ -1,11 +1,29 @@
 package data
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
 )
 
+var update = flag.Bool("update", false, "update golden files of parser tests")
+
+func parseTestDocument(t *testing.T, body string) *html.Node {
+	doc, err := parseDocument("test", body)
+	if err != nil {
+		t.Fatal("Failed to parse test document: ", err)
+	}
+	return doc
+}
+
 func TestFindBooks(t *testing.T) {
 	testInput := `
 (...)
@@ -40,17 +58,21 @@ func TestFindBooks(t *testing.T) {
 
 (...)
 `
-	books, err := findBooks(testInput)
+	books, err := findBooks(parseTestDocument(t, testInput))
 	assert.Nil(t, err)
 
 	expectedBooks := []Book{
 		{
 			Title:       "Shakespeare's Tragedy of Romeo and Juliet",
 			Author:      "William Shakespeare",
+			Downloads:   224,
+			CoverURL:    "/cache/epub/47960/pg47960.cover.small.jpg",
 			bookLinkref: "/ebooks/47960",
 		}, {
 			Title:       "Dramas de Guillermo Shakspeare [vol. 1] (Spanish)",
 			Author:      "William Shakespeare",
+			Downloads:   103,
+			CoverURL:    "/cache/epub/53207/pg53207.cover.small.jpg",
 			bookLinkref: "/ebooks/53207",
 		},
 	}
@@ -75,9 +97,199 @@ func TestFindTxtLinkref(t *testing.T) {
 
 (...)
 `
-	linkref, err := findTxtLinkref(testInput)
+	linkref, err := findTxtLinkref(parseTestDocument(t, testInput))
 	assert.Nil(t, err)
 
 	assert.Equal(t, "/files/32571/32571-0.txt", linkref)
 
 }
+
+func TestFindNextPageLinkref(t *testing.T) {
+	testInput := `
+(...)
+
+<ul class="results">
+<li class="statusline">
+<div class="padded">
+Displaying results 1&ndash;25 |
+<a title="Go to the next page of results." accesskey="+" href="/ebooks/search/?query=romeo&amp;start_index=26">Next</a>
+</div>
+</li>
+
+(...)
+`
+	linkref, ok := findNextPageLinkref(parseTestDocument(t, testInput))
+	assert.True(t, ok)
+	assert.Equal(t, "/ebooks/search/?query=romeo&start_index=26", linkref)
+
+	lastPage := `
+<div class="padded">
+<a title="Go to the previous page of results." accesskey="-" href="/ebooks/search/?query=romeo&amp;start_index=1">Previous</a> |
+Displaying results 26&ndash;33
+</div>
+`
+	_, ok = findNextPageLinkref(parseTestDocument(t, lastPage))
+	assert.False(t, ok)
+}
+
+func TestFindBookDetails(t *testing.T) {
+	testInput := `
+(...)
+
+<div id="cover">
+<img class="cover-art" src="/cache/epub/1513/pg1513.cover.medium.jpg" title="Book Cover" alt="Book Cover" itemprop="image" />
+</div>
+
+(...)
+
+<tr class="even" about="https://www.gutenberg.org/ebooks/1513.html.images" typeof="pgterms:file">
+<td><span class="icon icon_book"></span></td>
+<td property="dcterms:format" content="text/html" datatype="dcterms:IMT" class="unpadded icon_save"><a href="/ebooks/1513.html.images" type="text/html" class="link" title="Download">Read this book online: HTML</a></td>
+<td class="noscreen">https://www.gutenberg.org/ebooks/1513.html.images</td>
+<td class="right" property="dcterms:extent" content="185373">181 kB</td>
+</tr><tr class="odd" about="https://www.gutenberg.org/files/1513/1513-0.txt" typeof="pgterms:file">
+<td><span class="icon icon_book"></span></td>
+<td property="dcterms:format" content="text/plain; charset=utf-8" datatype="dcterms:IMT" class="unpadded icon_save"><a href="/files/1513/1513-0.txt" type="text/plain; charset=utf-8" class="link" title="Download">Plain Text UTF-8</a></td>
+<td class="noscreen">https://www.gutenberg.org/files/1513/1513-0.txt</td>
+<td class="right" property="dcterms:extent" content="167433">164 kB</td>
+</tr>
+
+(...)
+
+<table class="bibrec" summary="Bibliographic data of author and book.">
+<tr>
+<th>Author</th>
+<td><a href="/ebooks/author/65" rel="marcrel:aut" itemprop="creator">Shakespeare, William, 1564-1616</a></td>
+</tr>
+<tr>
+<th>Title</th>
+<td itemprop="headline">Romeo and Juliet</td>
+</tr>
+<tr property="dcterms:language" datatype="dcterms:RFC4646" itemprop="inLanguage" content="en">
+<th>Language</th>
+<td>English</td>
+</tr>
+<tr>
+<th>Subject</th>
+<td property="dcterms:subject" datatype="dcterms:LCSH"><a class="block" href="/ebooks/subject/118">Vendetta -- Drama</a></td>
+</tr>
+<tr>
+<th>Subject</th>
+<td property="dcterms:subject" datatype="dcterms:LCSH"><a class="block" href="/ebooks/subject/119">Verona (Italy) -- Drama</a></td>
+</tr>
+<tr>
+<th>Release Date</th>
+<td itemprop="datePublished">Nov 1, 1998</td>
+</tr>
+<tr>
+<th>Downloads</th>
+<td itemprop="interactionCount">17412 downloads in the last 30 days.</td>
+</tr>
+</table>
+
+(...)
+`
+	expected := Book{
+		Title:       "Romeo and Juliet",
+		Author:      "Shakespeare, William, 1564-1616",
+		Language:    "English",
+		Subjects:    []string{"Vendetta -- Drama", "Verona (Italy) -- Drama"},
+		ReleaseDate: "Nov 1, 1998",
+		Downloads:   17412,
+		Formats: []Format{
+			{Name: "Read this book online: HTML", Type: "text/html", URL: "/ebooks/1513.html.images"},
+			{Name: "Plain Text UTF-8", Type: "text/plain; charset=utf-8", URL: "/files/1513/1513-0.txt"},
+		},
+		CoverURL: "/cache/epub/1513/pg1513.cover.medium.jpg",
+	}
+
+	assert.Equal(t, expected, findBookDetails(parseTestDocument(t, testInput)))
+}
+
+// parsedPage gathers everything parsers find on a page, so it can be compared with golden file
+type parsedPage struct {
+	Books       []parsedBook `json:"books"`
+	BooksError  string       `json:"books_error,omitempty"`
+	NextPage    string       `json:"next_page,omitempty"`
+	TxtLinkref  string       `json:"txt_linkref,omitempty"`
+	TxtError    string       `json:"txt_error,omitempty"`
+	Fallback    string       `json:"fallback_edition,omitempty"`
+	BookDetails Book         `json:"book_details"`
+}
+
+type parsedBook struct {
+	Book
+	Linkref string `json:"linkref"`
+}
+
+func parsePage(doc *html.Node) parsedPage {
+	var page parsedPage
+
+	books, err := findBooks(doc)
+	if err != nil {
+		page.BooksError = err.Error()
+	}
+	for _, book := range books {
+		page.Books = append(page.Books, parsedBook{Book: book, Linkref: book.bookLinkref})
+	}
+
+	page.NextPage, _ = findNextPageLinkref(doc)
+
+	page.TxtLinkref, err = findTxtLinkref(doc)
+	if err != nil {
+		page.TxtError = err.Error()
+	}
+
+	if linkref, mimeType, ok := findFallbackEdition(doc); ok {
+		page.Fallback = fmt.Sprintf("%s (%s)", linkref, mimeType)
+	}
+
+	page.BookDetails = findBookDetails(doc)
+	return page
+}
+
+// TestParserGolden runs all parsers over pages saved in testdata and compares results with golden files,
+// run with -update flag to regenerate golden files after parser changes
+func TestParserGolden(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join("testdata", "*.html"))
+	if err != nil {
+		t.Fatal("Failed to list test pages: ", err)
+	}
+
+	for _, page := range pages {
+		t.Run(fmt.Sprintf("page:'%s'", filepath.Base(page)), func(t *testing.T) {
+			body, err := ioutil.ReadFile(page)
+			if err != nil {
+				t.Fatal("Failed to read test page: ", err)
+			}
+
+			actual, err := json.MarshalIndent(parsePage(parseTestDocument(t, string(body))), "", "  ")
+			if err != nil {
+				t.Fatal("Failed to marshal parsed page: ", err)
+			}
+			actual = append(actual, '\n')
+
+			golden := strings.TrimSuffix(page, ".html") + ".golden"
+			if *update {
+				if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+					t.Fatal("Failed to update golden file: ", err)
+				}
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal("Failed to read golden file: ", err)
+			}
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestFindBooksParseError(t *testing.T) {
+	_, err := findBooks(parseTestDocument(t, "<html><body><p>Service unavailable</p></body></html>"))
+
+	var parseErr *ParseError
+	if assert.True(t, errors.As(err, &parseErr)) {
+		assert.Equal(t, "search results", parseErr.Page)
+	}
+}
@@ -1,29 +1,53 @@
 package data
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"math/rand"
+	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/net/html"
 )
 
 type Book struct {
 	Title  string
 	Author string
 
+	Language    string   // eg. "English"
+	Subjects    []string // eg. "Vendetta -- Drama"
+	ReleaseDate string   // as presented by Gutenberg, eg. "Nov 1, 1998"
+	Downloads   int      // number of downloads in the last 30 days
+	Formats     []Format // available editions
+	CoverURL    string
+
 	bookLinkref string // eg. "/ebooks/34505", can be treated as unique ID
 }
 
+// Format describes downloadable edition of a book
+type Format struct {
+	Name string // eg. "Plain Text UTF-8"
+	Type string // MIME type, eg. "text/plain; charset=utf-8"
+	URL  string
+}
+
 type errNoLinkRef struct{}
 
 func (e *errNoLinkRef) Error() string {
 	return "txt linkref is not available"
 }
 
+func (e *errNoLinkRef) Is(target error) bool {
+	_, ok := target.(*errNoLinkRef)
+	return ok
+}
+
 func errTxtLinkRefNotAvailable() error { return &errNoLinkRef{} }
 
 var ErrTxtLinkRefNotAvailable = errTxtLinkRefNotAvailable()
@@ -32,6 +56,47 @@ func (b *Book) ID() string {
 	return b.bookLinkref
 }
 
+// EbookID returns Gutenberg ebook number of the book, eg. 1513 for "/ebooks/1513"
+func (b *Book) EbookID() (int, bool) {
+	if !strings.HasPrefix(b.bookLinkref, "/ebooks/") {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(b.bookLinkref, "/ebooks/"))
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// withDetails fills book metadata with details read from the book page, already known values are kept
+func (b Book) withDetails(details Book) Book {
+	if b.Title == "" {
+		b.Title = details.Title
+	}
+	if b.Author == "" {
+		b.Author = details.Author
+	}
+	if details.Language != "" {
+		b.Language = details.Language
+	}
+	if len(details.Subjects) > 0 {
+		b.Subjects = details.Subjects
+	}
+	if details.ReleaseDate != "" {
+		b.ReleaseDate = details.ReleaseDate
+	}
+	if details.Downloads > 0 {
+		b.Downloads = details.Downloads
+	}
+	if len(details.Formats) > 0 {
+		b.Formats = details.Formats
+	}
+	if details.CoverURL != "" {
+		b.CoverURL = details.CoverURL
+	}
+	return b
+}
+
 func NewBook(title, author, linkref string) (Book, error) {
 	if linkref == "" {
 		return Book{}, errors.New("linkref is required")
@@ -49,139 +114,473 @@ func NewBook(title, author, linkref string) (Book, error) {
 }
 
 type Provider interface {
-	GetBooks(title string) ([]Book, error)
+	GetBooks(query BookQuery) ([]Book, error)
 	DownloadBook(book Book) (string, error)
+	// BookDetails returns given book supplemented with metadata available on the book page only
+	BookDetails(book Book) (Book, error)
+}
+
+// Validators identify fetched version of a book text, they allow to download it again only if it was modified
+type Validators struct {
+	ETag         string
+	LastModified string
+	Source       string // URL which issued the validators, eg. of zipped edition or of a particular mirror
+}
+
+// setConditions makes request conditional if the validators were issued for its URL, validators of other files
+// or mirrors could match a different content
+func (v Validators) setConditions(request *http.Request) {
+	if v.Source == "" || v.Source != request.URL.String() {
+		return
+	}
+	if v.ETag != "" {
+		request.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		request.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+func validatorsOf(resp *http.Response) Validators {
+	return Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Source:       resp.Request.URL.String(),
+	}
+}
+
+// ErrNotModified is returned by Revalidator when book did not change since it was fetched
+var ErrNotModified = errors.New("not modified")
+
+// Revalidator is implemented by providers able to download book only if it changed since it was fetched
+type Revalidator interface {
+	// DownloadBookIfModified returns book content with validators of fetched version, or ErrNotModified if the
+	// book did not change since the version described by given validators was fetched. Empty validators, or
+	// validators issued by another source (Validators.Source), make the download unconditional.
+	DownloadBookIfModified(book Book, validators Validators) (string, Validators, error)
 }
 
-func randomRange(a, b time.Duration) time.Duration {
-	rawI := rand.Intn(int(b - a))
-	return time.Duration(int(a) + rawI)
+// PopularLister is implemented by providers able to list the most popular books
+type PopularLister interface {
+	// PopularBooks lists n books most downloaded recently, the most popular first
+	PopularBooks(n int) ([]Book, error)
+}
+
+// BookOpener is implemented by providers able to stream book text, so it can be searched without being loaded into
+// memory as a whole
+type BookOpener interface {
+	// OpenBook opens text of given book entry for reading, the caller closes it
+	OpenBook(book Book) (io.ReadCloser, error)
 }
 
 type httpProvider struct {
 	Client http.Client
 
-	domain    string
-	userAgent string
+	sites       []*mirror // mirrors of the whole website, the first one is used for absolute urls
+	files       []*mirror // mirrors of the file tree, tried for downloads before sites
+	userAgent   string
+	maxPages    int
+	maxResults  int
+	compression bool         // prefer zipped editions and gzip encoded responses
+	limiter     *rateLimiter // politeness limit of requests to remote mirrors
+	robots      bool         // honor robots.txt of remote mirrors
 }
 
 func (p *httpProvider) baseUrl() string {
-	return fmt.Sprintf("https://%s", p.domain)
+	return p.sites[0].String()
 }
 
-// GetBooks return search results of title query.
-func (p *httpProvider) GetBooks(title string) ([]Book, error) {
-	// Function could return more results than first 25 popular matches by iterating through pages
-	// but I decided not to du it, searching in 25 books for a query should be more than enough already
-	query := url.QueryEscape(title)
-
-	requestUrl := p.baseUrl() + "/ebooks/search/?query=" + query + "&submit_search=Go%21"
+// fetch requests linkref from given mirrors in order of their health. Mirror which fails or throttles is marked
+// unhealthy and the next one is tried. Request is conditional when validators of previously fetched version are
+// given, ErrNotModified is returned then if the file did not change. Caller is responsible for closing body of
+// returned response.
+func (p *httpProvider) fetch(mirrors []*mirror, linkref string, validators Validators) (*http.Response, error) {
+	var failure error
+	for _, m := range byHealth(mirrors) {
+		request, err := http.NewRequest(http.MethodGet, m.urlOf(linkref), nil)
+		if err != nil {
+			return nil, fmt.Errorf("preparing request failed: %w", err)
+		}
+		request.Header.Set("User-Agent", p.userAgent)
+		if p.compression {
+			// set explicitly, so the response is decoded the same way for every transport
+			request.Header.Set("Accept-Encoding", "gzip")
+		}
+		validators.setConditions(request)
+
+		if m.url.Scheme != "file" {
+			if p.robots {
+				if err := p.checkCrawlPolicy(m, linkref); err != nil {
+					failure = err
+					var disallowed *DisallowedError
+					if !errors.As(err, &disallowed) {
+						retryAfter, _ := RetryAfter(err)
+						m.markFailure(err, retryAfter)
+					}
+					continue
+				}
+			}
+			p.limiter.wait()
+		}
+		resp, err := p.Client.Do(request)
+		if err != nil {
+			failure = fmt.Errorf("request failed: %w", err)
+			m.markFailure(failure, 0)
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			m.markSuccess()
+			// validators of the response are issued for the requested URL, even if it was redirected
+			resp.Request = request
+			resp.Body, err = decodedBody(resp)
+			if err != nil {
+				return nil, err
+			}
+			resp.Header.Del("Content-Encoding")
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotModified {
+			m.markSuccess()
+			return nil, ErrNotModified
+		}
+		if failing(resp.StatusCode) {
+			statusErr := newStatusError(resp, time.Now())
+			failure = statusErr
+			m.markFailure(statusErr, statusErr.RetryAfter)
+			continue
+		}
+		m.markSuccess()
+	}
 
-	request, err := http.NewRequest(http.MethodGet, requestUrl, nil)
-	if err != nil {
-		return []Book{}, fmt.Errorf("preparing request failed: %w", err)
+	if failure != nil {
+		return nil, failure
 	}
-	request.Header.Set("User-Agent", p.userAgent)
+	return nil, fmt.Errorf("%s: %w", linkref, errNotFound)
+}
 
-	resp, err := p.Client.Do(request)
+// getPage returns body of the page available under given linkref
+func (p *httpProvider) getPage(linkref string) (string, error) {
+	resp, err := p.fetch(p.sites, linkref, Validators{})
 	if err != nil {
-		return []Book{}, fmt.Errorf("request failed: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return []Book{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading response failed: %w", err)
 	}
+	return string(body), nil
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// getDocument returns parsed page available under given linkref, page names kind of the page for parse errors
+func (p *httpProvider) getDocument(page, linkref string) (*html.Node, error) {
+	body, err := p.getPage(linkref)
 	if err != nil {
+		return nil, err
+	}
+	return parseDocument(page, body)
+}
+
+// GetBooks return search results of given query. Results are read page by page following "next" links until
+// maxPages or maxResults limit is reached.
+func (p *httpProvider) GetBooks(query BookQuery) ([]Book, error) {
+	if query.Empty() {
+		return []Book{}, errors.New("query requires title, author, subject or bookshelf")
+	}
+	if err := query.Validate(); err != nil {
 		return []Book{}, err
 	}
+	return p.listBooks(query.listingLinkref(), query.matches, p.maxPages, p.maxResults)
+}
 
-	books, err := findBooks(string(body))
-	if err != nil {
-		return books, fmt.Errorf("books not found: %w", err)
+// PopularBooks lists n books most downloaded from Gutenberg in the last 30 days
+func (p *httpProvider) PopularBooks(n int) ([]Book, error) {
+	if n < 1 {
+		return []Book{}, nil
+	}
+	pages := (n + booksPerPage - 1) / booksPerPage
+	all := func(Book) bool { return true }
+	return p.listBooks(popularLinkref, all, pages, n)
+}
+
+// listBooks reads listing pages starting with given linkref until maxPages or maxResults limit is reached, listed
+// books not matching the filter are skipped
+func (p *httpProvider) listBooks(linkref string, matches func(Book) bool, maxPages, maxResults int) ([]Book, error) {
+	var books []Book
+	for page := 1; ; page++ {
+		doc, err := p.getDocument("search results", linkref)
+		if err != nil {
+			if page > 1 {
+				// results of previous pages are still valid
+				log.Printf("Reading results page %d failed: %s", page, err)
+				break
+			}
+			return []Book{}, err
+		}
+
+		pageBooks, err := findBooks(doc)
+		if err != nil {
+			if page > 1 {
+				break
+			}
+			return pageBooks, fmt.Errorf("books not found: %w", err)
+		}
+		for _, book := range pageBooks {
+			book.CoverURL = p.absoluteUrl(book.CoverURL)
+			if matches(book) {
+				books = append(books, book)
+			}
+		}
+
+		if maxResults > 0 && len(books) >= maxResults {
+			books = books[:maxResults]
+			break
+		}
+		if page >= maxPages {
+			break
+		}
+
+		next, ok := findNextPageLinkref(doc)
+		if !ok {
+			break
+		}
+		linkref = relativeLinkref(next)
 	}
 
 	return books, nil
 }
 
-// findTxtLinkRef returns linkref to txt version of given book, returns empty string if txt version is not available
-func (p *httpProvider) findTxtLinkRef(book Book) (string, error) {
-	requestUrl := fmt.Sprintf("%s%s", p.baseUrl(), book.bookLinkref)
+// edition is a downloadable file book content can be read from
+type edition struct {
+	linkref  string
+	mimeType string // editionText, editionHTML or editionEPUB
+}
 
-	request, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+// findEdition looks up book page for plain text edition, HTML or EPUB edition is returned when there is no plain text
+func (p *httpProvider) findEdition(book Book) (edition, error) {
+	doc, err := p.getDocument("book", book.bookLinkref)
 	if err != nil {
-		return "", fmt.Errorf("preparing request failed: %w", err)
+		return edition{}, err
 	}
 
-	request.Header.Set("User-Agent", p.userAgent)
+	linkref, err := findTxtLinkref(doc)
+	if err == nil {
+		return edition{linkref: linkref, mimeType: editionText}, nil
+	}
+	if linkref, mimeType, ok := findFallbackEdition(doc); ok {
+		return edition{linkref: linkref, mimeType: mimeType}, nil
+	}
+	return edition{}, fmt.Errorf("finding txt linkref failed: %w", err)
+}
 
-	resp, err := p.Client.Do(request)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+// relativeLinkref strips scheme and host of absolute urls found on pages, so they can be requested from any mirror
+func relativeLinkref(href string) string {
+	u, err := url.Parse(href)
+	if err != nil || u.Host == "" {
+		return href
 	}
-	defer resp.Body.Close()
+	return u.RequestURI()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// absoluteUrl turns linkrefs found on pages into absolute urls
+func (p *httpProvider) absoluteUrl(linkref string) string {
+	if linkref == "" || strings.Contains(linkref, "://") {
+		return linkref
+	}
+	if !strings.HasPrefix(linkref, "/") {
+		linkref = "/" + linkref
 	}
+	return p.baseUrl() + linkref
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// BookDetails reads metadata from the book page.
+func (p *httpProvider) BookDetails(book Book) (Book, error) {
+	doc, err := p.getDocument("book", book.bookLinkref)
 	if err != nil {
-		return "", fmt.Errorf("reading response failed: %w", err)
+		return book, err
 	}
 
-	linkref, err := findTxtLinkref(string(body))
+	details := findBookDetails(doc)
+	details.CoverURL = p.absoluteUrl(details.CoverURL)
+	for i := range details.Formats {
+		details.Formats[i].URL = p.absoluteUrl(details.Formats[i].URL)
+	}
+	return book.withDetails(details), nil
+}
+
+// openBook opens text version of given book entry unless it did not change since it was fetched with given
+// validators. File mirrors are tried first, book page of a site mirror is looked up for the text edition otherwise.
+func (p *httpProvider) openBook(book Book, validators Validators) (io.ReadCloser, Validators, error) {
+	if id, ok := book.EbookID(); ok && len(p.files) > 0 {
+		for _, e := range fileTreeEditions(id) {
+			body, fetched, err := p.openEdition(p.files, e, validators)
+			if err == nil || errors.Is(err, ErrNotModified) {
+				return body, fetched, err
+			}
+			if !errors.Is(err, errNotFound) {
+				log.Printf("Downloading book %d from file mirrors failed: %s", id, err)
+				break
+			}
+		}
+	}
+
+	e, err := p.findEdition(book)
 	if err != nil {
-		return "", fmt.Errorf("finding txt linkref failed: %w", err)
+		return nil, Validators{}, fmt.Errorf("failed to get txt linkref: %w", err)
+	}
+	if e.mimeType != editionText {
+		log.Printf("Plain text of %s is not available, extracting text from %s edition", book.ID(), e.mimeType)
 	}
 
-	return linkref, nil
+	e.linkref = relativeLinkref(e.linkref)
+	return p.openEdition(p.sites, e, validators)
 }
 
-// DownloadBook tries to download text version of given book entry.
-func (p *httpProvider) DownloadBook(book Book) (string, error) {
-	linkRef, err := p.findTxtLinkRef(book)
-	if err != nil {
-		return "", fmt.Errorf("failed to get txt linkref: %w", err)
+// openEdition opens given edition for reading as plain text
+func (p *httpProvider) openEdition(mirrors []*mirror, e edition, validators Validators) (io.ReadCloser, Validators, error) {
+	if e.mimeType == editionText {
+		return p.openText(mirrors, e.linkref, validators)
 	}
-	// some sleep to pretend real-human operation
-	time.Sleep(randomRange(time.Millisecond*500, time.Second*2))
 
-	requestUrl := fmt.Sprintf("%s%s", p.baseUrl(), linkRef)
+	resp, err := p.fetch(mirrors, e.linkref, validators)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	defer resp.Body.Close()
 
-	request, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	text, err := extractText(resp.Body, e.mimeType)
 	if err != nil {
-		return "", fmt.Errorf("preparing request failed: %w", err)
+		return nil, Validators{}, fmt.Errorf("extracting text of %s failed: %w", e.linkref, err)
 	}
+	return ioutil.NopCloser(strings.NewReader(text)), validatorsOf(resp), nil
+}
 
-	request.Header.Set("User-Agent", p.userAgent)
+// openText opens plain text file of given linkref, its zipped edition is preferred when compression is enabled.
+// Validators are tied to the URL which issued them, so plain text fallback is not conditioned by zip validators.
+func (p *httpProvider) openText(mirrors []*mirror, linkref string, validators Validators) (io.ReadCloser, Validators, error) {
+	if zipped, ok := zipLinkref(linkref); ok && p.compression {
+		resp, err := p.fetch(mirrors, zipped, validators)
+		if err == nil {
+			body, err := openZippedText(resp.Body)
+			resp.Body.Close()
+			if err == nil {
+				return body, validatorsOf(resp), nil
+			}
+			log.Printf("Reading %s failed, falling back to plain text: %s", zipped, err)
+		} else if errors.Is(err, ErrNotModified) || errors.Is(err, context.Canceled) {
+			return nil, Validators{}, err
+		} else if !errors.Is(err, errNotFound) {
+			// eg. failing mirror or zip files disallowed by robots.txt, plain text may be still available
+			log.Printf("Downloading %s failed, falling back to plain text: %s", zipped, err)
+		}
+	}
 
-	resp, err := p.Client.Do(request)
+	resp, err := p.fetch(mirrors, linkref, validators)
 	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+		return nil, Validators{}, err
 	}
-	defer resp.Body.Close()
+	return resp.Body, validatorsOf(resp), nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// OpenBook opens text version of given book entry for reading
+func (p *httpProvider) OpenBook(book Book) (io.ReadCloser, error) {
+	body, _, err := p.openBook(book, Validators{})
+	return body, err
+}
+
+// DownloadBook tries to download text version of given book entry.
+func (p *httpProvider) DownloadBook(book Book) (string, error) {
+	content, _, err := p.DownloadBookIfModified(book, Validators{})
+	return content, err
+}
+
+// DownloadBookIfModified downloads text version of given book entry unless it did not change since it was fetched
+// with given validators.
+func (p *httpProvider) DownloadBookIfModified(book Book, validators Validators) (string, Validators, error) {
+	body, fetched, err := p.openBook(book, validators)
+	if err != nil {
+		return "", Validators{}, err
 	}
+	defer body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	content, err := ioutil.ReadAll(body)
 	if err != nil {
-		return "", fmt.Errorf("reading response failed: %w", err)
+		return "", Validators{}, fmt.Errorf("reading response failed: %w", err)
 	}
 
-	return string(body), nil
+	return string(content), fetched, nil
 }
 
-func NewProvider(userAgent string, timeout time.Duration) Provider {
+// ProviderConfig configures Gutenberg provider
+type ProviderConfig struct {
+	UserAgent  string        // user-agent header used for requests
+	Timeout    time.Duration // http client timeout
+	MaxPages   int           // number of search result pages read for a single query (25 results per page)
+	MaxResults int           // maximum number of books returned for a single query, 0 disables the limit
+
+	// mirrors of the whole website (http or https), tried in order with failover, DefaultMirror if empty
+	Mirrors []string
+	// mirrors of the file tree as distributed by rsync (http, https or file urls), books are downloaded from them
+	// before site mirrors are used
+	FileMirrors []string
+	// download zipped editions of books and request gzip encoded responses, plain text is used as a fallback
+	Compression bool
+	// requests per second allowed to be sent to remote mirrors (listings, book pages and downloads altogether),
+	// 0 disables the limit
+	RateLimit float64
+	// number of requests allowed to be sent at once before the rate limit applies
+	RateBurst int
+	// fetch and honor robots.txt of remote mirrors, disallowed requests fail with DisallowedError and requests are
+	// spaced according to Crawl-delay
+	Robots bool
+}
+
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	maxPages := cfg.MaxPages
+	if maxPages < 1 {
+		maxPages = 1
+	}
+
+	siteUrls := cfg.Mirrors
+	if len(siteUrls) == 0 {
+		siteUrls = []string{DefaultMirror}
+	}
+	sites, err := newMirrors(siteUrls, false)
+	if err != nil {
+		return nil, err
+	}
+	files, err := newMirrors(cfg.FileMirrors, true)
+	if err != nil {
+		return nil, err
+	}
+
 	return &httpProvider{
 		Client: http.Client{
-			Timeout: time.Second * 60,
+			Transport: newTransport(),
+			Timeout:   cfg.Timeout,
 		},
-		domain:    "www.gutenberg.org",
-		userAgent: userAgent,
+		sites:       sites,
+		files:       files,
+		userAgent:   cfg.UserAgent,
+		maxPages:    maxPages,
+		maxResults:  cfg.MaxResults,
+		compression: cfg.Compression,
+		limiter:     newRateLimiter(cfg.RateLimit, cfg.RateBurst),
+		robots:      cfg.Robots,
+	}, nil
+}
+
+func newMirrors(urls []string, files bool) ([]*mirror, error) {
+	mirrors := make([]*mirror, 0, len(urls))
+	for _, u := range urls {
+		m, err := newMirror(u, files)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, m)
 	}
+	return mirrors, nil
 }
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadBookIfModified(t *testing.T) {
+	etag := `"v1"`
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/5/1/1513/1513-0.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", "Thu, 01 Oct 2020 12:00:00 GMT")
+		_, _ = w.Write([]byte("Romeo and Juliet, " + etag))
+	}))
+	defer mirror.Close()
+
+	provider := newTestProvider(t, []string{mirror.URL}, []string{mirror.URL})
+	book, _ := NewBook("Romeo and Juliet", "", "/ebooks/1513")
+
+	content, validators, err := provider.DownloadBookIfModified(book, Validators{})
+	assert.Nil(t, err)
+	assert.Equal(t, `Romeo and Juliet, "v1"`, content)
+	assert.Equal(t, Validators{
+		ETag:         `"v1"`,
+		LastModified: "Thu, 01 Oct 2020 12:00:00 GMT",
+		Source:       mirror.URL + "/1/5/1/1513/1513-0.txt",
+	}, validators)
+
+	_, _, err = provider.DownloadBookIfModified(book, validators)
+	assert.True(t, errors.Is(err, ErrNotModified))
+
+	// new edition is downloaded in full
+	etag = `"v2"`
+	content, validators, err = provider.DownloadBookIfModified(book, validators)
+	assert.Nil(t, err)
+	assert.Equal(t, `Romeo and Juliet, "v2"`, content)
+	assert.Equal(t, `"v2"`, validators.ETag)
+}
+
+func TestPopularBooks(t *testing.T) {
+	page, err := ioutil.ReadFile(filepath.Join("testdata", "search_results.html"))
+	if err != nil {
+		t.Fatal("Failed to read test page: ", err)
+	}
+
+	var requested []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.RequestURI())
+		_, _ = w.Write(page)
+	}))
+	defer mirror.Close()
+
+	provider := newTestProvider(t, []string{mirror.URL}, nil)
+	books, err := provider.PopularBooks(2)
+	assert.Nil(t, err)
+
+	var ids []string
+	for _, book := range books {
+		ids = append(ids, book.ID())
+	}
+	assert.Equal(t, []string{"/ebooks/1513", "/ebooks/47960"}, ids)
+	assert.Equal(t, []string{"/ebooks/search/?sort_order=downloads"}, requested)
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// booksPerPage is number of books listed on a Gutenberg search results page
+const booksPerPage = 25
+
+// popularLinkref lists all books sorted by number of downloads in the last 30 days
+const popularLinkref = "/ebooks/search/?sort_order=downloads"
+
+// BookQuery describes criteria of books listing
+type BookQuery struct {
+	Title     string
+	Author    string
+	Subject   string
+	Language  string // language code, eg. "en"
+	Bookshelf int    // Gutenberg bookshelf ID, 0 if not used
+
+	// ebook ID range, 0 disables given bound
+	MinID int
+	MaxID int
+
+	// exact ebook IDs, books are then looked up directly and other criteria are not used
+	IDs []int
+}
+
+// Empty tells whether query has no criteria narrowing the listing down to a reasonable number of books
+func (q BookQuery) Empty() bool {
+	return q.Title == "" && q.Author == "" && q.Subject == "" && q.Bookshelf == 0 && len(q.IDs) == 0
+}
+
+// Validate reports combinations of criteria which cannot be applied to the listing
+func (q BookQuery) Validate() error {
+	if q.Bookshelf != 0 && (q.Subject != "" || q.Language != "") {
+		// bookshelf listing entries carry only titles and authors
+		return errors.New("bookshelf cannot be combined with subject or language")
+	}
+	if q.MinID < 0 || q.MaxID < 0 {
+		return errors.New("ebook ID range bounds cannot be negative")
+	}
+	if q.MinID != 0 && q.MaxID != 0 && q.MinID > q.MaxID {
+		return fmt.Errorf("ebook ID range is empty: min ID %d is greater than max ID %d", q.MinID, q.MaxID)
+	}
+	return nil
+}
+
+// Key returns representation of query suitable for cache keys, text criteria are quoted so that they cannot be
+// confused with the separators
+func (q BookQuery) Key() string {
+	if len(q.IDs) > 0 {
+		return fmt.Sprintf("ids:%v", q.IDs)
+	}
+	return fmt.Sprintf("t:%q|a:%q|s:%q|l:%q|bs:%d|id:%d-%d",
+		q.Title, q.Author, q.Subject, q.Language, q.Bookshelf, q.MinID, q.MaxID)
+}
+
+// Books returns books of directly requested ebook IDs, listing is not required for them
+func (q BookQuery) Books() ([]Book, error) {
+	books := make([]Book, 0, len(q.IDs))
+	for _, id := range q.IDs {
+		if id < 1 {
+			return nil, fmt.Errorf("invalid ebook ID: %d", id)
+		}
+		book, err := NewBook("", "", fmt.Sprintf("/ebooks/%d", id))
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, nil
+}
+
+func (q BookQuery) String() string {
+	if len(q.IDs) > 0 {
+		return fmt.Sprintf("ebook IDs %v", q.IDs)
+	}
+
+	var parts []string
+	for _, part := range []struct{ name, value string }{
+		{"title", q.Title},
+		{"author", q.Author},
+		{"subject", q.Subject},
+		{"language", q.Language},
+	} {
+		if part.value != "" {
+			parts = append(parts, fmt.Sprintf("%s \"%s\"", part.name, part.value))
+		}
+	}
+	if q.Bookshelf != 0 {
+		parts = append(parts, fmt.Sprintf("bookshelf %d", q.Bookshelf))
+	}
+	if q.MinID != 0 || q.MaxID != 0 {
+		parts = append(parts, fmt.Sprintf("ebook IDs %d-%d", q.MinID, q.MaxID))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// searchTerms returns query in Gutenberg search syntax, where every word of a criteria is prefixed with field
+// name, eg. "t.romeo t.juliet a.shakespeare l.en"
+func (q BookQuery) searchTerms() string {
+	var terms []string
+	for _, field := range []struct{ prefix, value string }{
+		{"t.", q.Title},
+		{"a.", q.Author},
+		{"s.", q.Subject},
+		{"l.", q.Language},
+	} {
+		for _, word := range strings.Fields(field.value) {
+			terms = append(terms, field.prefix+word)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// listingLinkref returns linkref of the first listing page for the query
+func (q BookQuery) listingLinkref() string {
+	if q.Bookshelf != 0 {
+		return fmt.Sprintf("/ebooks/bookshelf/%d", q.Bookshelf)
+	}
+	if q.Author == "" && q.Subject == "" && q.Language == "" {
+		// plain title query stays a free-text search, which matches authors and subjects as well
+		return "/ebooks/search/?query=" + url.QueryEscape(q.Title) + "&submit_search=Go%21"
+	}
+	return "/ebooks/search/?query=" + url.QueryEscape(q.searchTerms()) + "&submit_search=Go%21"
+}
+
+// matches filters listed books by criteria which could not be applied by the listing itself
+func (q BookQuery) matches(book Book) bool {
+	if q.MinID != 0 || q.MaxID != 0 {
+		id, ok := book.EbookID()
+		if !ok {
+			return false
+		}
+		if q.MinID != 0 && id < q.MinID {
+			return false
+		}
+		if q.MaxID != 0 && id > q.MaxID {
+			return false
+		}
+	}
+
+	if q.Bookshelf != 0 {
+		// bookshelf listing is not searchable, title and author are matched with the listing entries instead
+		if !containsFold(book.Title, q.Title) || !containsFold(book.Author, q.Author) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
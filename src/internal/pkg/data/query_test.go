@@ -0,0 +1,95 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookQueryListingLinkref(t *testing.T) {
+	type testCase struct {
+		query    BookQuery
+		expected string
+	}
+
+	testCases := []testCase{
+		{
+			query:    BookQuery{Title: "Romeo & Juliet"},
+			expected: "/ebooks/search/?query=Romeo+%26+Juliet&submit_search=Go%21",
+		}, {
+			query:    BookQuery{Title: "Romeo & Juliet", MinID: 1000},
+			expected: "/ebooks/search/?query=Romeo+%26+Juliet&submit_search=Go%21",
+		}, {
+			query:    BookQuery{Title: "romeo", Author: "William Shakespeare", Language: "en"},
+			expected: "/ebooks/search/?query=t.romeo+a.William+a.Shakespeare+l.en&submit_search=Go%21",
+		}, {
+			query:    BookQuery{Subject: "tragedies"},
+			expected: "/ebooks/search/?query=s.tragedies&submit_search=Go%21",
+		}, {
+			query:    BookQuery{Title: "romeo", Bookshelf: 39},
+			expected: "/ebooks/bookshelf/39",
+		},
+	}
+
+	for i, tc := range testCases {
+		name := fmt.Sprintf("%d:%s", i, tc.query)
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.query.listingLinkref())
+		})
+	}
+}
+
+func TestBookQueryMatches(t *testing.T) {
+	type testCase struct {
+		query    BookQuery
+		expected bool
+	}
+
+	book, err := NewBook("Romeo and Juliet", "William Shakespeare", "/ebooks/1513")
+	assert.Nil(t, err)
+
+	testCases := []testCase{
+		{query: BookQuery{Title: "romeo"}, expected: true},
+		{query: BookQuery{Title: "romeo", MinID: 1000, MaxID: 2000}, expected: true},
+		{query: BookQuery{Title: "romeo", MinID: 1514}, expected: false},
+		{query: BookQuery{Title: "romeo", MaxID: 1512}, expected: false},
+		{query: BookQuery{Title: "juliet", Bookshelf: 39}, expected: true},
+		{query: BookQuery{Author: "shakespeare", Bookshelf: 39}, expected: true},
+		{query: BookQuery{Title: "hamlet", Bookshelf: 39}, expected: false},
+	}
+
+	for i, tc := range testCases {
+		name := fmt.Sprintf("%d:%s", i, tc.query)
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.query.matches(book))
+		})
+	}
+}
+
+func TestBookQueryBooks(t *testing.T) {
+	books, err := BookQuery{IDs: []int{1513, 2261}}.Books()
+	assert.Nil(t, err)
+	assert.Equal(t, []Book{{bookLinkref: "/ebooks/1513"}, {bookLinkref: "/ebooks/2261"}}, books)
+
+	_, err = BookQuery{IDs: []int{1513, -1}}.Books()
+	assert.NotNil(t, err)
+}
+
+func TestBookQueryKey(t *testing.T) {
+	// criteria containing separators do not collide with other queries
+	assert.NotEqual(t, BookQuery{Title: "a|a:b"}.Key(), BookQuery{Title: "a", Author: "b"}.Key())
+	assert.NotEqual(t, BookQuery{Title: `a"|a:"b`}.Key(), BookQuery{Title: "a", Author: "b"}.Key())
+	assert.Equal(t, BookQuery{Title: "romeo"}.Key(), BookQuery{Title: "romeo"}.Key())
+}
+
+func TestBookQueryValidate(t *testing.T) {
+	assert.Nil(t, BookQuery{Title: "romeo", Author: "shakespeare", Bookshelf: 39}.Validate())
+	assert.Nil(t, BookQuery{Subject: "drama", Language: "en"}.Validate())
+	assert.NotNil(t, BookQuery{Subject: "drama", Bookshelf: 39}.Validate())
+	assert.NotNil(t, BookQuery{Title: "romeo", Language: "en", Bookshelf: 39}.Validate())
+	assert.Nil(t, BookQuery{Title: "romeo", MinID: 1513, MaxID: 1513}.Validate())
+	assert.Nil(t, BookQuery{Title: "romeo", MinID: 2000}.Validate())
+	assert.NotNil(t, BookQuery{Title: "romeo", MinID: 2000, MaxID: 1000}.Validate())
+	assert.NotNil(t, BookQuery{Title: "romeo", MaxID: -1}.Validate())
+}
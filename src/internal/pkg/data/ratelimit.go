@@ -0,0 +1,70 @@
+package data
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// rateLimitMetrics are published under "data_rate_limit" in /debug/vars
+var rateLimitMetrics = expvar.NewMap("data_rate_limit")
+
+// rateLimiter is a token bucket shared by all requests of a provider. Bucket holds up to burst tokens and is refilled
+// with rate tokens per second, every request takes a single token or waits until one is available.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns limiter allowing rate requests per second with bursts of given size, rate lower or equal
+// to 0 disables the limit
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns time the caller has to wait for it. Tokens are taken in advance, so concurrent
+// callers are queued in order of their calls.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait blocks until request is allowed and returns time spent waiting
+func (l *rateLimiter) wait() time.Duration {
+	if l == nil || l.rate <= 0 {
+		return 0
+	}
+
+	wait := l.reserve(time.Now())
+	rateLimitMetrics.Add("requests", 1)
+	if wait > 0 {
+		rateLimitMetrics.Add("delayed_requests", 1)
+		rateLimitMetrics.Add("wait_ns", int64(wait))
+		time.Sleep(wait)
+	}
+	return wait
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	type testCase struct {
+		after    time.Duration // since the previous reservation
+		expected time.Duration
+	}
+
+	// 2 requests per second with bursts of 3 requests
+	testCases := []testCase{
+		{after: 0, expected: 0},
+		{after: 0, expected: 0},
+		{after: 0, expected: 0},
+		{after: 0, expected: time.Millisecond * 500},
+		{after: 0, expected: time.Second},
+		{after: time.Second * 2, expected: 0}, // refilled 4 tokens, 2 of them were already taken in advance
+		{after: 0, expected: 0},
+		{after: time.Millisecond * 250, expected: time.Millisecond * 250},
+		{after: 0, expected: time.Millisecond * 750},
+	}
+
+	limiter := newRateLimiter(2, 3)
+	now := limiter.last
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%d'", i), func(t *testing.T) {
+			now = now.Add(tc.after)
+			assert.Equal(t, tc.expected, limiter.reserve(now))
+		})
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter := newRateLimiter(0, 1)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Duration(0), limiter.wait())
+	}
+}
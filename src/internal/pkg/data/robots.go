@@ -0,0 +1,241 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsExpiration is how long fetched robots.txt is used before it is fetched again
+const robotsExpiration = time.Hour * 24
+
+// DisallowedError is returned when crawl policy of a mirror (robots.txt) does not allow to request given path
+type DisallowedError struct {
+	URL string
+}
+
+func (e *DisallowedError) Error() string {
+	return fmt.Sprintf("request to %s is disallowed by robots.txt", e.URL)
+}
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// robotsRules are rules of robots.txt group applicable to our user agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsGroup is a group of rules of robots.txt shared by listed user agents
+type robotsGroup struct {
+	agents []string
+	robotsRules
+}
+
+// parseRobots reads robots.txt and returns rules of the group matching given user agent product token best, eg.
+// "fuzzy-search" for "fuzzy-search/1.0 (+contact)". Group of "*" applies if there is no specific group.
+func parseRobots(r io.Reader, userAgent string) (robotsRules, error) {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	var rulesStarted bool
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if current == nil || rulesStarted {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				rulesStarted = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			rulesStarted = true
+			if value == "" {
+				// empty disallow allows everything
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{pattern: value, allow: key == "allow"})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			rulesStarted = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return robotsRules{}, fmt.Errorf("reading robots.txt failed: %w", err)
+	}
+
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var rules robotsRules
+	var matched int // length of the most specific matching agent, 0 for "*"
+	found := false
+	for _, group := range groups {
+		for _, agent := range group.agents {
+			switch {
+			case agent == "*" && !found:
+				rules, found = group.robotsRules, true
+			case agent != "*" && token != "" && strings.Contains(token, agent) && len(agent) > matched:
+				rules, found, matched = group.robotsRules, true, len(agent)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// allowed tells whether path (including query) may be requested, the longest matching rule wins and allow rule wins
+// over disallow rule of the same length
+func (r robotsRules) allowed(path string) bool {
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// robotsMatch matches path with robots.txt pattern, "*" matches any sequence of characters and "$" anchors the end
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	if anchored && len(parts) == 1 {
+		return path == parts[0]
+	}
+
+	rest := path[len(parts[0]):]
+	middle := parts[1:]
+	if anchored {
+		// the last part has to end the path
+		middle = parts[1 : len(parts)-1]
+	}
+	for _, part := range middle {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	return !anchored || strings.HasSuffix(rest, parts[len(parts)-1])
+}
+
+// crawlPolicy keeps robots.txt rules of a mirror and spaces requests to it according to Crawl-delay
+type crawlPolicy struct {
+	mu          sync.Mutex
+	rules       robotsRules
+	fetched     time.Time
+	nextRequest time.Time
+}
+
+// robotsPolicy returns crawl rules of the mirror, robots.txt is fetched when not known yet or expired. Missing
+// robots.txt allows everything, server errors are returned so the request can be retried later.
+func (p *httpProvider) robotsPolicy(m *mirror) (robotsRules, error) {
+	m.crawl.mu.Lock()
+	defer m.crawl.mu.Unlock()
+	if !m.crawl.fetched.IsZero() && time.Since(m.crawl.fetched) < robotsExpiration {
+		return m.crawl.rules, nil
+	}
+
+	// robots.txt is always placed in the root of the host, even if the mirror itself is not
+	robotsUrl := url.URL{Scheme: m.url.Scheme, Host: m.url.Host, Path: "/robots.txt"}
+	request, err := http.NewRequest(http.MethodGet, robotsUrl.String(), nil)
+	if err != nil {
+		return robotsRules{}, fmt.Errorf("preparing robots.txt request failed: %w", err)
+	}
+	request.Header.Set("User-Agent", p.userAgent)
+
+	p.limiter.wait()
+	resp, err := p.Client.Do(request)
+	if err != nil {
+		return robotsRules{}, fmt.Errorf("robots.txt request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var rules robotsRules
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		rules, err = parseRobots(resp.Body, p.userAgent)
+		if err != nil {
+			return robotsRules{}, err
+		}
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		// robots.txt is not available, there are no restrictions
+	default:
+		return robotsRules{}, newStatusError(resp, time.Now())
+	}
+
+	m.crawl.rules = rules
+	m.crawl.fetched = time.Now()
+	return rules, nil
+}
+
+// checkCrawlPolicy returns DisallowedError if the mirror does not allow to request given linkref, otherwise it waits
+// for the crawl delay requested by the mirror
+func (p *httpProvider) checkCrawlPolicy(m *mirror, linkref string) error {
+	rules, err := p.robotsPolicy(m)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(linkref, "/") {
+		linkref = "/" + linkref
+	}
+	if !rules.allowed(m.url.Path + linkref) {
+		return &DisallowedError{URL: m.urlOf(linkref)}
+	}
+	if rules.crawlDelay <= 0 {
+		return nil
+	}
+
+	m.crawl.mu.Lock()
+	now := time.Now()
+	wait := m.crawl.nextRequest.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	m.crawl.nextRequest = now.Add(wait + rules.crawlDelay)
+	m.crawl.mu.Unlock()
+
+	if wait > 0 {
+		rateLimitMetrics.Add("crawl_delay_wait_ns", int64(wait))
+		time.Sleep(wait)
+	}
+	return nil
+}
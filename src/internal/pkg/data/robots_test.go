@@ -0,0 +1,146 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRobots = `# robots.txt
+User-agent: *
+Disallow: /ebooks/search
+Crawl-delay: 5
+
+User-agent: fuzzy
+User-agent: fuzzy-search
+Disallow: /cache/
+Allow: /cache/epub/*.txt$
+Crawl-delay: 0.5
+
+User-agent: other-bot
+Disallow: /
+`
+
+func TestParseRobots(t *testing.T) {
+	type testCase struct {
+		userAgent  string
+		patterns   []string
+		crawlDelay time.Duration
+	}
+
+	testCases := []testCase{
+		{
+			userAgent:  "fuzzy-search/1.0 (Project Gutenberg phrase search service)",
+			patterns:   []string{"/cache/", "/cache/epub/*.txt$"},
+			crawlDelay: time.Millisecond * 500,
+		}, {
+			userAgent:  "Mozilla/5.0 (X11; Linux x86_64; rv:80.0) Gecko/20100101 Firefox/80.0",
+			patterns:   []string{"/ebooks/search"},
+			crawlDelay: time.Second * 5,
+		}, {
+			userAgent:  "",
+			patterns:   []string{"/ebooks/search"},
+			crawlDelay: time.Second * 5,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.userAgent), func(t *testing.T) {
+			rules, err := parseRobots(strings.NewReader(testRobots), tc.userAgent)
+			if !assert.Nil(t, err) {
+				return
+			}
+			var patterns []string
+			for _, rule := range rules.rules {
+				patterns = append(patterns, rule.pattern)
+			}
+			assert.Equal(t, tc.patterns, patterns)
+			assert.Equal(t, tc.crawlDelay, rules.crawlDelay)
+		})
+	}
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	rules := robotsRules{rules: []robotsRule{
+		{pattern: "/cache/"},
+		{pattern: "/cache/epub/*.txt$", allow: true},
+		{pattern: "/files/*.zip"},
+		{pattern: "/ebooks/"},
+		{pattern: "/ebooks/", allow: true},
+	}}
+
+	testCases := map[string]bool{
+		"/":                              true,
+		"/cache/epub/1513/pg1513.epub":   false,
+		"/cache/epub/1513/pg1513.txt":    true,
+		"/cache/epub/1513/pg1513.txt.gz": false,
+		"/files/1513/1513-0.zip":         false,
+		"/files/1513/1513-0.txt":         true,
+		"/ebooks/1513":                   true,
+	}
+
+	for path, expected := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", path), func(t *testing.T) {
+			assert.Equal(t, expected, rules.allowed(path))
+		})
+	}
+}
+
+func TestFetchDisallowed(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte(testRobots))
+			return
+		}
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	provider := newTestProvider(t, []string{server.URL}, nil)
+	provider.robots = true
+	provider.userAgent = "fuzzy-search/1.0"
+
+	_, err := provider.getPage("/cache/epub/1513/pg1513.epub")
+	var disallowed *DisallowedError
+	assert.True(t, errors.As(err, &disallowed))
+	assert.True(t, IsPermanent(err))
+	// disallowed request is not a failure of the mirror
+	assert.True(t, provider.sites[0].healthy(time.Now()))
+
+	_, err = provider.getPage("/ebooks/1513")
+	assert.Nil(t, err)
+	// robots.txt is fetched once and disallowed page is never requested
+	assert.Equal(t, []string{"/robots.txt", "/ebooks/1513"}, requested)
+}
+
+func TestOpenTextZipDisallowed(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /files/*.zip\n"))
+			return
+		}
+		_, _ = w.Write([]byte("Romeo and Juliet"))
+	}))
+	defer server.Close()
+
+	provider := newTestProvider(t, []string{server.URL}, nil)
+	provider.robots = true
+	provider.compression = true
+
+	body, _, err := provider.openText(provider.sites, "/files/1513/1513-0.txt", Validators{})
+	if assert.Nil(t, err) {
+		body.Close()
+	}
+	// plain text is downloaded instead of disallowed zipped edition
+	assert.Equal(t, []string{"/robots.txt", "/files/1513/1513-0.txt"}, requested)
+}
@@ -0,0 +1,72 @@
+package search
+
+// bkTree is a Burkhard-Keller tree of words, it allows to find all words within given edit distance without
+// comparing query with every word stored in the tree
+type bkTree struct {
+	root *bkNode
+	size int
+}
+
+type bkNode struct {
+	word     string
+	children map[int]*bkNode // key: distance between child and this node word
+}
+
+// Add inserts word into the tree, duplicates are ignored
+func (t *bkTree) Add(word string) {
+	if t.root == nil {
+		t.root = &bkNode{word: word}
+		t.size++
+		return
+	}
+
+	node := t.root
+	for {
+		distance := wordDistance(word, node.word)
+		if distance == 0 {
+			return
+		}
+		child, ok := node.children[distance]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[distance] = &bkNode{word: word}
+			t.size++
+			return
+		}
+		node = child
+	}
+}
+
+// Find returns all words that are not further than maxDistance from given word
+func (t *bkTree) Find(word string, maxDistance int) []string {
+	var found []string
+	if t.root == nil {
+		return found
+	}
+
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		distance := wordDistance(word, node.word)
+		if distance <= maxDistance {
+			found = append(found, node.word)
+		}
+
+		// triangle inequality limits children worth visiting to the (distance-max, distance+max) range
+		for childDistance, child := range node.children {
+			if childDistance >= distance-maxDistance && childDistance <= distance+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return found
+}
+
+// Len returns number of unique words stored in the tree
+func (t *bkTree) Len() int {
+	return t.size
+}
@@ -0,0 +1,37 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBKTreeFind(t *testing.T) {
+	type testCase struct {
+		word        string
+		maxDistance int
+		expected    []string
+	}
+
+	testCases := []testCase{
+		{word: "romeo", maxDistance: 0, expected: []string{"romeo"}},
+		{word: "romeo", maxDistance: 1, expected: []string{"romeo", "romeos", "rome"}},
+		{word: "rome", maxDistance: 2, expected: []string{"romeo", "romeos", "rome"}},
+		{word: "juliet", maxDistance: 1, expected: []string{"juliet", "iuliet"}},
+		{word: "mercutio", maxDistance: 2, expected: nil},
+	}
+
+	tree := &bkTree{}
+	for _, word := range []string{"romeo", "romeos", "rome", "juliet", "iuliet", "romeo", "capulet"} {
+		tree.Add(word)
+	}
+	assert.Equal(t, 6, tree.Len())
+
+	for _, tc := range testCases {
+		name := fmt.Sprintf("word:'%s'/%d", tc.word, tc.maxDistance)
+		t.Run(name, func(t *testing.T) {
+			assert.ElementsMatch(t, tc.expected, tree.Find(tc.word, tc.maxDistance))
+		})
+	}
+}
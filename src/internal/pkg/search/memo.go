@@ -0,0 +1,58 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+)
+
+const memoSize = 16 // number of per-book structures kept in memory by searchers
+
+// fingerprint identifies book content for reuse of structures built from it, also by other processes sharing the
+// index store, so collision resistant hash is used
+func fingerprint(content string) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// memo keeps limited number of recently built per-book structures, oldest entries are dropped first
+type memo struct {
+	size int
+
+	mu    sync.Mutex
+	items map[string]interface{}
+	order []string // insertion order, oldest first
+}
+
+func newMemo(size int) *memo {
+	return &memo{
+		size:  size,
+		items: make(map[string]interface{}),
+	}
+}
+
+func (m *memo) Get(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.items[key]
+	return value, ok
+}
+
+func (m *memo) Set(key string, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.items[key]; ok {
+		m.items[key] = value
+		return
+	}
+	if len(m.order) >= m.size {
+		delete(m.items, m.order[0])
+		m.order = m.order[1:]
+	}
+	m.items[key] = value
+	m.order = append(m.order, key)
+}
@@ -0,0 +1,154 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	StopWordsMatch  = "match"  // stop words are matched the same way as other words
+	StopWordsExact  = "exact"  // stop words have to match exactly (distance 0)
+	StopWordsIgnore = "ignore" // stop words are skipped, they neither have to match nor count into distances
+)
+
+// Options control when a sequence of book words is accepted as an occurrence of searched phrase
+type Options struct {
+	MaxDistance         int     // maximum distance of a single word
+	MaxTotalDistance    int     // maximum sum of distances of matched words, negative value disables the limit
+	MaxRelativeDistance float64 // maximum distance of a single word relative to its length, 0 disables the limit
+	MinMatchedFraction  float64 // fraction of phrase words that has to match, 1 requires all of them
+	StopWords           string  // stop words handling, StopWordsMatch, StopWordsExact or StopWordsIgnore
+	Language            string  // language of stop words list
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxDistance:         2,
+		MaxTotalDistance:    -1,
+		MaxRelativeDistance: 0,
+		MinMatchedFraction:  1,
+		StopWords:           StopWordsExact,
+		Language:            DefaultLanguage,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.MaxDistance < 0 {
+		return fmt.Errorf("max distance cannot be negative")
+	}
+	if o.MaxRelativeDistance < 0 {
+		return fmt.Errorf("max relative distance cannot be negative")
+	}
+	if o.MinMatchedFraction <= 0 || o.MinMatchedFraction > 1 {
+		return fmt.Errorf("min matched fraction has to be in (0, 1] range")
+	}
+	switch o.StopWords {
+	case StopWordsMatch, StopWordsExact, StopWordsIgnore:
+	default:
+		return fmt.Errorf("unsupported stop words handling: '%s'", o.StopWords)
+	}
+	if _, ok := stopWords[o.Language]; !ok {
+		return fmt.Errorf("unsupported language: '%s' (supported: %s)", o.Language, strings.Join(Languages(), ", "))
+	}
+	return nil
+}
+
+// Key returns representation of options suitable for cache keys
+func (o Options) Key() string {
+	return fmt.Sprintf("%d:%d:%g:%g:%s:%s",
+		o.MaxDistance, o.MaxTotalDistance, o.MaxRelativeDistance, o.MinMatchedFraction, o.StopWords, o.Language)
+}
+
+func (o Options) isStopWord(word string) bool {
+	return isStopWord(o.Language, word)
+}
+
+// maxWordDistance returns maximum acceptable distance of a book word from given phrase word
+func (o Options) maxWordDistance(phraseWord string) int {
+	if o.StopWords == StopWordsExact && o.isStopWord(phraseWord) {
+		return 0
+	}
+	maxDistance := o.MaxDistance
+	if o.MaxRelativeDistance > 0 {
+		relative := int(math.Floor(o.MaxRelativeDistance * float64(utf8.RuneCountInString(phraseWord))))
+		if relative < maxDistance {
+			maxDistance = relative
+		}
+	}
+	return maxDistance
+}
+
+// exactOnly tells whether only exact occurrences of the whole phrase are accepted
+func (o Options) exactOnly() bool {
+	return o.MaxDistance <= 0 && o.MinMatchedFraction >= 1 && o.StopWords != StopWordsIgnore
+}
+
+// scored returns indexes of phrase words which take part in scoring
+func (o Options) scored(phraseWords []string) []int {
+	var scored []int
+	for i, word := range phraseWords {
+		if o.StopWords == StopWordsIgnore && o.isStopWord(word) {
+			continue
+		}
+		scored = append(scored, i)
+	}
+	if len(scored) == 0 {
+		// phrase consists of stop words only, all of them have to be taken into account
+		for i := range phraseWords {
+			scored = append(scored, i)
+		}
+	}
+	return scored
+}
+
+// required returns number of scored words that have to match
+func (o Options) required(scored int) int {
+	required := int(math.Ceil(o.MinMatchedFraction*float64(scored) - 1e-9))
+	if required < 1 {
+		required = 1
+	}
+	return required
+}
+
+// anchors returns indexes of phrase words of which at least one has to match in every accepted occurrence, so
+// candidates for phrase occurrences can be generated from these words only. The rarest words according to given
+// frequency are selected, as they produce the smallest number of candidates.
+func (o Options) anchors(phraseWords []string, frequency func(i int) int) []int {
+	scored := o.scored(phraseWords)
+	allowedMisses := len(scored) - o.required(len(scored))
+
+	frequencies := make(map[int]int, len(scored))
+	for _, i := range scored {
+		frequencies[i] = frequency(i)
+	}
+	sort.SliceStable(scored, func(a, b int) bool { return frequencies[scored[a]] < frequencies[scored[b]] })
+
+	return scored[:allowedMisses+1]
+}
+
+// score compares phrase words with book words returned by word(i), where i is an index of phrase word.
+// It returns summed distance of matched words and whether the occurrence is accepted.
+func (o Options) score(phraseWords []string, word func(i int) string) (int, bool) {
+	scored := o.scored(phraseWords)
+	allowedMisses := len(scored) - o.required(len(scored))
+
+	var total, misses int
+	for _, i := range scored {
+		distance := wordDistance(phraseWords[i], word(i))
+		if distance > o.maxWordDistance(phraseWords[i]) {
+			misses++
+			if misses > allowedMisses {
+				return total, false
+			}
+			continue
+		}
+		total += distance
+		if o.MaxTotalDistance >= 0 && total > o.MaxTotalDistance {
+			return total, false
+		}
+	}
+	return total, true
+}
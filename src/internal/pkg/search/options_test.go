@@ -0,0 +1,83 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsScore(t *testing.T) {
+	type testCase struct {
+		phrase   string
+		words    string
+		opts     Options
+		expected bool
+	}
+
+	defaults := DefaultOptions()
+	withTotal := DefaultOptions()
+	withTotal.MaxTotalDistance = 2
+	withRelative := DefaultOptions()
+	withRelative.MaxRelativeDistance = 0.34
+	withFraction := DefaultOptions()
+	withFraction.MinMatchedFraction = 0.75
+	withIgnore := DefaultOptions()
+	withIgnore.StopWords = StopWordsIgnore
+	withMatch := DefaultOptions()
+	withMatch.StopWords = StopWordsMatch
+	german := DefaultOptions()
+	german.Language = "de"
+
+	testCases := []testCase{
+		{phrase: "o romeo romeo", words: "o romeo romeo", opts: defaults, expected: true},
+		{phrase: "o romeo romeo", words: "my romea romeo", opts: defaults, expected: false},
+		{phrase: "o romeo romeo", words: "my romea romeo", opts: withMatch, expected: true},
+		{phrase: "o romeo romeo", words: "o romea romeo", opts: defaults, expected: true},
+		{phrase: "der zauberberg", words: "die zauberberg", opts: defaults, expected: true},
+		{phrase: "der zauberberg", words: "die zauberberg", opts: german, expected: false},
+		{phrase: "o romeo romeo", words: "my romea romea", opts: withTotal, expected: false},
+		{phrase: "o romeo romeo", words: "my romeo romeo", opts: withRelative, expected: false},
+		{phrase: "sweet romeo", words: "sweete romeo", opts: withRelative, expected: true},
+		{phrase: "wherefore art thou romeo", words: "wherefore art thou juliet", opts: defaults, expected: false},
+		{phrase: "wherefore art thou romeo", words: "wherefore art thou juliet", opts: withFraction, expected: true},
+		{phrase: "wherefore art thou romeo", words: "wherefore is it romeo", opts: withIgnore, expected: true},
+		{phrase: "wherefore art thou romeo", words: "wherefore is it romeo", opts: defaults, expected: false},
+	}
+
+	for _, tc := range testCases {
+		name := fmt.Sprintf("phrase:'%s'/words:'%s'", tc.phrase, tc.words)
+		t.Run(name, func(t *testing.T) {
+			words := strings.Fields(tc.words)
+			_, ok := tc.opts.score(strings.Fields(tc.phrase), func(i int) string { return words[i] })
+			assert.Equal(t, tc.expected, ok)
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	assert.Nil(t, DefaultOptions().Validate())
+
+	for _, opts := range []Options{
+		{MaxDistance: -1, MinMatchedFraction: 1, StopWords: StopWordsMatch, Language: DefaultLanguage},
+		{MaxRelativeDistance: -0.5, MinMatchedFraction: 1, StopWords: StopWordsMatch, Language: DefaultLanguage},
+		{MinMatchedFraction: 0, StopWords: StopWordsMatch, Language: DefaultLanguage},
+		{MinMatchedFraction: 1.5, StopWords: StopWordsMatch, Language: DefaultLanguage},
+		{MinMatchedFraction: 1, StopWords: "sometimes", Language: DefaultLanguage},
+		{MinMatchedFraction: 1, StopWords: StopWordsExact, Language: "xx"},
+	} {
+		assert.NotNil(t, opts.Validate(), "%#v", opts)
+	}
+}
+
+func TestOptionsAnchors(t *testing.T) {
+	phrase := strings.Fields("to be or not to be that is the question")
+	frequency := map[string]int{"to": 900, "be": 400, "or": 300, "not": 500, "that": 700, "is": 800, "the": 999}
+
+	opts := DefaultOptions()
+	assert.Equal(t, []int{9}, opts.anchors(phrase, func(i int) int { return frequency[phrase[i]] }))
+
+	opts.MinMatchedFraction = 0.8
+	assert.Equal(t, []int{9, 2, 1}, opts.anchors(phrase, func(i int) int { return frequency[phrase[i]] }))
+}
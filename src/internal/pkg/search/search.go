@@ -3,10 +3,8 @@ package search
 import (
 	"errors"
 	"math/rand"
-	"strings"
+	"sort"
 	"time"
-
-	"github.com/lithammer/fuzzysearch/fuzzy"
 )
 
 type Result struct {
@@ -15,12 +13,12 @@ type Result struct {
 }
 
 type Searcher interface {
-	Search(content string, phrase string) (Result, error)
+	Search(content string, phrase string, opts Options) (Result, error)
 }
 
 type localSearcher struct {
-	maxDistance  int
 	randomResult bool
+	vocabularies *memo // key: content fingerprint
 }
 
 type Indexes struct {
@@ -60,6 +58,11 @@ func BookFields(s string, cap int) ([]string, []Indexes) {
 			}
 		}
 	}
+	if state == TextState {
+		// content does not end with whitespace
+		fields = append(fields, s[textBeginning:])
+		indexes = append(indexes, Indexes{textBeginning, len(s)})
+	}
 	return fields, indexes
 }
 
@@ -68,56 +71,69 @@ const (
 	TextState
 )
 
-func (l *localSearcher) Search(content string, phrase string) (Result, error) {
-	var indexes = make([]Indexes, 0)
-
-	contentFields, contentIndexes := BookFields(content, 100)
-	phraseFields := strings.Fields(phrase)
+func (l *localSearcher) vocabulary(content string) *vocabulary {
+	key := fingerprint(content)
+	if v, ok := l.vocabularies.Get(key); ok {
+		return v.(*vocabulary)
+	}
+	v := newVocabulary(content)
+	l.vocabularies.Set(key, v)
+	return v
+}
 
-	if len(phraseFields) < 1 {
+func (l *localSearcher) Search(content string, phrase string, opts Options) (Result, error) {
+	phraseWords := normalizeWords(phrase)
+	if len(phraseWords) < 1 {
 		return Result{}, errors.New("pattern not found")
 	}
 
-	firstPhraseField := phraseFields[0]
-	ranks := fuzzy.RankFindFold(firstPhraseField, contentFields)
+	v := l.vocabulary(content)
 
-	var filteredRanks fuzzy.Ranks
-	for _, rank := range ranks {
-		if rank.Distance > l.maxDistance {
-			continue
-		}
-		filteredRanks = append(filteredRanks, rank)
-	}
-	if len(filteredRanks) == 0 {
-		return Result{}, errors.New("pattern not found")
+	// positions of words similar to every phrase word, rarest of them are used as anchors
+	positions := make([][]int, len(phraseWords))
+	for i, word := range phraseWords {
+		positions[i] = v.candidates(word, opts.maxWordDistance(word))
 	}
 
-	for _, rank := range filteredRanks {
-		for i, phraseField := range phraseFields[1:] {
-			targetIndex := rank.OriginalIndex + 1 + i
-			secondRanks := fuzzy.RankFindFold(phraseField, []string{contentFields[targetIndex]})
-			if len(secondRanks) == 0 {
-				// no match
-				continue
-			}
-			if secondRanks[0].Distance > l.maxDistance {
+	// every occurrence of a word similar to one of anchor words determines a candidate for phrase beginning
+	candidates := make(map[int]bool)
+	for _, anchor := range opts.anchors(phraseWords, func(i int) int { return len(positions[i]) }) {
+		for _, position := range positions[anchor] {
+			start := position - anchor
+			if start < 0 || start+len(phraseWords) > len(v.words) {
 				continue
 			}
-			if i == len(phraseFields)-2 {
-				// achieved full query pass successfully
-				firstWord := rank.OriginalIndex
-				lastWord := rank.OriginalIndex + len(phraseFields) - 1
-				indexes = append(indexes, Indexes{contentIndexes[firstWord].a, contentIndexes[lastWord].b})
-			}
+			candidates[start] = true
 		}
 	}
 
+	starts := make([]int, 0, len(candidates))
+	for start := range candidates {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+
+	var indexes = make([]Indexes, 0)
+	for _, start := range starts {
+		_, ok := opts.score(phraseWords, func(i int) string { return v.words[start+i] })
+		if !ok {
+			continue
+		}
+		lastWord := start + len(phraseWords) - 1
+		indexes = append(indexes, Indexes{v.indexes[start].a, v.indexes[lastWord].b})
+	}
+
+	return pick(content, indexes, l.randomResult)
+}
+
+// pick returns first or random match from given positions
+func pick(content string, indexes []Indexes, random bool) (Result, error) {
 	if len(indexes) == 0 {
 		return Result{}, errors.New("pattern not found")
 	}
 
 	var choice Indexes
-	if l.randomResult {
+	if random {
 		choice = indexes[rand.Intn(len(indexes))]
 	} else {
 		choice = indexes[0]
@@ -130,13 +146,13 @@ func (l *localSearcher) Search(content string, phrase string) (Result, error) {
 	}, nil
 }
 
-func NewSearcher(maxDistance int, randomResult bool) Searcher {
+func NewSearcher(randomResult bool) Searcher {
 	if randomResult {
 		rand.Seed(time.Now().UnixNano())
 	}
 
 	return &localSearcher{
-		maxDistance:  maxDistance,
-		randomResult: true,
+		randomResult: randomResult,
+		vocabularies: newMemo(memoSize),
 	}
 }
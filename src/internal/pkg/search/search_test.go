@@ -0,0 +1,48 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	type testCase struct {
+		phrase   string
+		expected Result
+	}
+
+	testCases := []testCase{
+		{phrase: "wherefore art thou Romeo", expected: Result{"wherefore art thou Romeo?", 53896, 53921}},
+		{phrase: "wherfore art thou romeo", expected: Result{"wherefore art thou Romeo?", 53896, 53921}},
+		{phrase: "denie thy father\nand refuse", expected: Result{"Denie thy Father and refuse", 53923, 53950}},
+	}
+
+	content := loadTestBook(t)
+	searcher := NewSearcher(false)
+
+	for _, tc := range testCases {
+		name := fmt.Sprintf("phrase:'%s'", tc.phrase)
+		t.Run(name, func(t *testing.T) {
+			result, err := searcher.Search(content, tc.phrase, DefaultOptions())
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestSearchNotFound(t *testing.T) {
+	content := loadTestBook(t)
+	searcher := NewSearcher(false)
+	opts := DefaultOptions()
+	opts.MaxDistance = 1
+
+	for _, phrase := range []string{"", "   ", "to be or not to be", "Take all my selfe and more"} {
+		name := fmt.Sprintf("phrase:'%s'", phrase)
+		t.Run(name, func(t *testing.T) {
+			_, err := searcher.Search(content, phrase, opts)
+			assert.NotNil(t, err)
+		})
+	}
+}
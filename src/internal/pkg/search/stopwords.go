@@ -0,0 +1,56 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+const DefaultLanguage = "en"
+
+// stopWordLists contains most frequent function words of supported languages, words are normalized the same way
+// as book content (lower-cased, without surrounding punctuation)
+var stopWordLists = map[string]string{
+	"en": `a about after again all am an and any are as at be been before but by can did do does for from had has
+		have he her him his how i if in into is it its me my no nor not now o of off on or our out she so such than
+		that the their them then there these they this those to too up us very was we were what when where which
+		who whom why will with would you your
+		art thee thou thy thine ye hath doth tis`, // early modern English, common in Gutenberg classics
+	"de": `aber alle als also am an auch auf aus bei bin bis da das dass dem den der des die dir doch du ein eine
+		einem einen einer es für hat hatte ich ihm ihn ihr im in ist ja kein mich mir mit nach nicht noch nun nur ob
+		oder sein sich sie sind so um und uns von vor war was wie wir wird zu zum zur`,
+	"fr": `à au aux avec ce ces dans de des du elle en et eux il ils je la le les leur lui ma mais me même mes moi
+		mon ne nos notre nous on ou où par pas pour qu que qui sa se ses son sur ta te tes toi ton tu un une vos
+		votre vous y`,
+	"es": `a al algo como con de del el ella ellos en era es esta este fue ha la las le les lo los me mi mis muy
+		más ni no nos o os para pero por que qué se si sin su sus te tu tus un una y ya yo`,
+	"it": `a ad al alla alle che chi ci con da dal dalla de dei del della di e ed era gli ha i il in io la le lei
+		lo loro lui ma mi mia mio ne negli nel nella noi non o per più quella quello questa questo se si sono su
+		sua suo tu un una uno vi voi`,
+}
+
+var stopWords = map[string]map[string]bool{}
+
+func init() {
+	for language, list := range stopWordLists {
+		words := make(map[string]bool)
+		for _, word := range strings.Fields(list) {
+			words[word] = true
+		}
+		stopWords[language] = words
+	}
+}
+
+// Languages returns codes of languages with stop words lists available
+func Languages() []string {
+	languages := make([]string, 0, len(stopWords))
+	for language := range stopWords {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// isStopWord tells whether given normalized word is a stop word of given language
+func isStopWord(language, word string) bool {
+	return stopWords[language][word]
+}
@@ -0,0 +1,204 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const DefaultChunkSize = 64 * 1024
+
+// StreamSearcher searches phrase in content read from r, content is processed in chunks so it never has to be
+// loaded into memory as a whole. Returned positions are byte offsets in the stream, the same as Searcher returns
+// for the whole content. Up to tail bytes of content starting at the match are returned along, so the match can be
+// put into context once the stream is gone.
+type StreamSearcher interface {
+	SearchReader(r io.Reader, phrase string, opts Options, tail int) (Result, string, error)
+}
+
+type streamSearcher struct {
+	randomResult bool
+	chunkSize    int
+}
+
+type streamWord struct {
+	word       string // normalized
+	posS, posE int    // absolute position in stream
+}
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case ' ', '\n', '\t', '\r':
+		return true
+	}
+	return false
+}
+
+// window keeps last len(phrase) words read from the stream
+type window struct {
+	words []streamWord
+	next  int // position of the oldest word once window is full
+	full  bool
+}
+
+func (w *window) push(word streamWord) {
+	if !w.full {
+		w.words = append(w.words, word)
+		w.full = len(w.words) == cap(w.words)
+		return
+	}
+	w.words[w.next] = word
+	w.next = (w.next + 1) % len(w.words)
+}
+
+func (w *window) at(i int) streamWord {
+	return w.words[(w.next+i)%len(w.words)]
+}
+
+func (w *window) matches(phraseWords []string, opts Options) bool {
+	if !w.full {
+		return false
+	}
+	_, ok := opts.score(phraseWords, func(i int) string { return w.at(i).word })
+	return ok
+}
+
+// appendTail appends b to tail up to size bytes
+func appendTail(tail, b []byte, size int) []byte {
+	if free := size - len(tail); len(b) > free {
+		if free < 0 {
+			free = 0
+		}
+		b = b[:free]
+	}
+	return append(tail, b...)
+}
+
+// readTail keeps reading r until tail has size bytes or the stream ends
+func readTail(r io.Reader, tail []byte, size int, chunk []byte) ([]byte, error) {
+	for len(tail) < size {
+		n, err := r.Read(chunk)
+		tail = appendTail(tail, chunk[:n], size)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return tail, fmt.Errorf("reading content failed: %w", err)
+		}
+	}
+	return tail, nil
+}
+
+// SearchReader searches phrase in content read from r in chunks, only words of the sliding window and the tail of
+// the chosen match are kept in memory.
+func (s *streamSearcher) SearchReader(r io.Reader, phrase string, opts Options, tail int) (Result, string, error) {
+	phraseWords := normalizeWords(phrase)
+	if len(phraseWords) < 1 {
+		return Result{}, "", errors.New("pattern not found")
+	}
+
+	var (
+		win     = window{words: make([]streamWord, 0, len(phraseWords))}
+		buf     []byte // stream content starting at base offset
+		base    int
+		scanned int // buffer position up to which content was already tokenized
+		matches int
+		choice  Result
+		context []byte // content following start of the choice, up to tail bytes
+		chunk   = make([]byte, s.chunkSize)
+	)
+
+	for eof := false; !eof; {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if matches > 0 {
+			context = appendTail(context, chunk[:n], tail)
+		}
+		if err == io.EOF {
+			eof = true
+		} else if err != nil {
+			return Result{}, "", fmt.Errorf("reading content failed: %w", err)
+		}
+
+		// tokenize complete words, word touching end of the buffer may continue in the next chunk
+		for i := scanned; i < len(buf); {
+			if isWhitespace(buf[i]) {
+				i++
+				scanned = i
+				continue
+			}
+			start := i
+			for i < len(buf) && !isWhitespace(buf[i]) {
+				i++
+			}
+			if i == len(buf) && !eof {
+				break
+			}
+			scanned = i
+
+			word := normalizeWord(string(buf[start:i]))
+			if word == "" {
+				continue
+			}
+			win.push(streamWord{word: word, posS: base + start, posE: base + i})
+
+			if !win.matches(phraseWords, opts) {
+				continue
+			}
+			first, last := win.at(0), win.at(len(phraseWords)-1)
+			matches++
+			if !s.randomResult || rand.Intn(matches) == 0 {
+				choice = Result{
+					Phrase: string(buf[first.posS-base : last.posE-base]),
+					PosS:   first.posS,
+					PosE:   last.posE,
+				}
+				context = appendTail(context[:0], buf[first.posS-base:], tail)
+			}
+			if !s.randomResult {
+				context, err = readTail(r, context, tail, chunk)
+				if err != nil {
+					return Result{}, "", err
+				}
+				return choice, string(context), nil
+			}
+		}
+
+		// drop bytes that can't be a part of any future match
+		keep := scanned
+		if len(win.words) > 0 && win.at(0).posS-base < keep {
+			keep = win.at(0).posS - base
+		}
+		buf = buf[keep:]
+		base += keep
+		scanned -= keep
+	}
+
+	if matches == 0 {
+		return Result{}, "", errors.New("pattern not found")
+	}
+	return choice, string(context), nil
+}
+
+func (s *streamSearcher) Search(content string, phrase string, opts Options) (Result, error) {
+	result, _, err := s.SearchReader(strings.NewReader(content), phrase, opts, 0)
+	return result, err
+}
+
+// NewStreamSearcher returns Searcher which compares phrase with sliding window of words read in chunks of
+// chunkSize bytes, random result is selected with reservoir sampling so the whole content is never kept in memory.
+func NewStreamSearcher(randomResult bool, chunkSize int) Searcher {
+	if randomResult {
+		rand.Seed(time.Now().UnixNano())
+	}
+	if chunkSize < 1 {
+		chunkSize = DefaultChunkSize
+	}
+
+	return &streamSearcher{
+		randomResult: randomResult,
+		chunkSize:    chunkSize,
+	}
+}
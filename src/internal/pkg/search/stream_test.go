@@ -0,0 +1,76 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamSearchSameAsSearch(t *testing.T) {
+	phrases := []string{
+		"wherefore art thou Romeo",
+		"wherfore art thou romeo",
+		"denie thy father\nand refuse",
+		"Take all my selfe",
+		"The Tragedie of Romeo",
+	}
+
+	content := loadTestBook(t)
+	searcher := NewSearcher(false)
+
+	for _, chunkSize := range []int{1, 7, 4096, DefaultChunkSize} {
+		streamSearcher := NewStreamSearcher(false, chunkSize).(StreamSearcher)
+
+		for _, phrase := range phrases {
+			name := fmt.Sprintf("chunk:%d/phrase:'%s'", chunkSize, phrase)
+			t.Run(name, func(t *testing.T) {
+				expected, err := searcher.Search(content, phrase, DefaultOptions())
+				assert.Nil(t, err)
+
+				result, tail, err := streamSearcher.SearchReader(strings.NewReader(content), phrase, DefaultOptions(), 300)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, result)
+				assert.Equal(t, content[result.PosS:result.PosS+300], tail)
+			})
+		}
+	}
+}
+
+func TestStreamSearchTail(t *testing.T) {
+	content := loadTestBook(t)
+	phrase := "wherefore art thou Romeo"
+
+	for _, chunkSize := range []int{1, 7, 4096} {
+		for _, size := range []int{0, 10, len(content)} {
+			name := fmt.Sprintf("chunk:%d/tail:%d", chunkSize, size)
+			t.Run(name, func(t *testing.T) {
+				// random result keeps reading the whole content, tail is collected for the chosen match only
+				searcher := NewStreamSearcher(true, chunkSize).(StreamSearcher)
+				result, tail, err := searcher.SearchReader(strings.NewReader(content), phrase, DefaultOptions(), size)
+				assert.Nil(t, err)
+				end := result.PosS + size
+				if end > len(content) {
+					end = len(content)
+				}
+				assert.Equal(t, content[result.PosS:end], tail)
+			})
+		}
+	}
+}
+
+func TestStreamSearchNotFound(t *testing.T) {
+	content := loadTestBook(t)
+	searcher := NewStreamSearcher(true, 16)
+	opts := DefaultOptions()
+	opts.MaxDistance = 1
+
+	for _, phrase := range []string{"", "to be or not to be", "Take all my selfe and more"} {
+		name := fmt.Sprintf("phrase:'%s'", phrase)
+		t.Run(name, func(t *testing.T) {
+			_, err := searcher.Search(content, phrase, opts)
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"index/suffixarray"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	indexMagic   = "FSIX"
+	indexVersion = 1
+)
+
+var ErrIndexFormat = errors.New("unsupported index format")
+
+type indexedWord struct {
+	n          int // start of the word in normalized text
+	length     int // length of the word in normalized text
+	posS, posE int // position of the word in original content
+}
+
+// Index is a suffix array built over normalized book content. Normalized text consists of lower-cased words
+// stripped from surrounding punctuation and separated by single space, so lookups do not depend on line wrapping.
+type Index struct {
+	words []indexedWord
+	sa    *suffixarray.Index
+}
+
+// NewIndex builds suffix array index for given book content
+func NewIndex(content string) *Index {
+	fields, indexes := BookFields(content, len(content)/6)
+
+	var text bytes.Buffer
+	text.Grow(len(content))
+	words := make([]indexedWord, 0, len(fields))
+
+	for i, field := range fields {
+		word := normalizeWord(field)
+		if word == "" {
+			continue
+		}
+		if text.Len() > 0 {
+			text.WriteByte(' ')
+		}
+		words = append(words, indexedWord{
+			n:      text.Len(),
+			length: len(word),
+			posS:   indexes[i].a,
+			posE:   indexes[i].b,
+		})
+		text.WriteString(word)
+	}
+
+	return &Index{
+		words: words,
+		sa:    suffixarray.New(text.Bytes()),
+	}
+}
+
+func (ix *Index) word(i int) string {
+	w := ix.words[i]
+	return string(ix.sa.Bytes()[w.n : w.n+w.length])
+}
+
+// wordAt returns index of a word beginning exactly at given normalized text offset, -1 otherwise
+func (ix *Index) wordAt(offset int) int {
+	i := sort.Search(len(ix.words), func(i int) bool { return ix.words[i].n >= offset })
+	if i < len(ix.words) && ix.words[i].n == offset {
+		return i
+	}
+	return -1
+}
+
+// lookupWords returns indexes of words (ordered by position) that begins sequence of given normalized words
+func (ix *Index) lookupWords(words []string) []int {
+	pattern := []byte(strings.Join(words, " "))
+	text := ix.sa.Bytes()
+
+	var found []int
+	for _, offset := range ix.sa.Lookup(pattern, -1) {
+		end := offset + len(pattern)
+		if end < len(text) && text[end] != ' ' {
+			continue
+		}
+		i := ix.wordAt(offset)
+		if i < 0 {
+			continue
+		}
+		found = append(found, i)
+	}
+	sort.Ints(found)
+	return found
+}
+
+// Lookup returns positions in original content of phrase occurrences. Exact occurrences are preferred, when there
+// are none, occurrences accepted by given options are returned. Fuzzy candidates are found with seed-and-extend
+// approach: every phrase word is looked up exactly in the suffix array and neighbouring words of each hit are
+// compared with the rest of the phrase, so at least one phrase word has to match exactly.
+func (ix *Index) Lookup(phrase string, opts Options) []Indexes {
+	words := normalizeWords(phrase)
+	if len(words) == 0 || len(ix.words) == 0 {
+		return nil
+	}
+
+	if exact := ix.lookupWords(words); len(exact) > 0 || opts.exactOnly() {
+		return ix.spans(exact, len(words))
+	}
+
+	// every scored word is a seed, rarest seeds are tried first
+	seeds := opts.scored(words)
+	hits := make(map[int][]int, len(seeds))
+	for _, seed := range seeds {
+		hits[seed] = ix.lookupWords(words[seed : seed+1])
+	}
+	sort.SliceStable(seeds, func(i, j int) bool { return len(hits[seeds[i]]) < len(hits[seeds[j]]) })
+
+	matched := make(map[int]bool)
+	for _, seed := range seeds {
+		for _, hit := range hits[seed] {
+			start := hit - seed
+			if start < 0 || start+len(words) > len(ix.words) || matched[start] {
+				continue
+			}
+			if _, ok := opts.score(words, func(i int) string { return ix.word(start + i) }); ok {
+				matched[start] = true
+			}
+		}
+	}
+
+	starts := make([]int, 0, len(matched))
+	for start := range matched {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+	return ix.spans(starts, len(words))
+}
+
+func (ix *Index) spans(starts []int, length int) []Indexes {
+	spans := make([]Indexes, 0, len(starts))
+	for _, start := range starts {
+		spans = append(spans, Indexes{ix.words[start].posS, ix.words[start+length-1].posE})
+	}
+	return spans
+}
+
+// Write serializes index, it can be loaded back with ReadIndex
+func (ix *Index) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(indexMagic); err != nil {
+		return err
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v int) error {
+		n := binary.PutUvarint(buf, uint64(v))
+		_, err := bw.Write(buf[:n])
+		return err
+	}
+
+	if err := putUvarint(indexVersion); err != nil {
+		return err
+	}
+	if err := putUvarint(len(ix.words)); err != nil {
+		return err
+	}
+	for _, w := range ix.words {
+		for _, v := range []int{w.n, w.length, w.posS, w.posE} {
+			if err := putUvarint(v); err != nil {
+				return err
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return ix.sa.Write(w)
+}
+
+// indexMaxValue bounds offsets and lengths of serialized indexes, indexed texts are smaller than that
+const indexMaxValue = math.MaxInt32
+
+// indexWordSize is the minimum size of a serialized word, 4 varints of 1 byte at least
+const indexWordSize = 4
+
+// ReadIndex loads index serialized with Index.Write. Truncated or damaged indexes, eg. written by other version of
+// the application, are refused with ErrIndexFormat.
+func ReadIndex(r io.Reader) (*Index, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(indexMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("reading header failed: %w", err)
+	}
+	if string(magic) != indexMagic {
+		return nil, ErrIndexFormat
+	}
+
+	readUvarint := func() (int, error) {
+		v, err := binary.ReadUvarint(br)
+		if err == nil && v > indexMaxValue {
+			return 0, fmt.Errorf("%w: value %d out of range", ErrIndexFormat, v)
+		}
+		return int(v), err
+	}
+
+	version, err := readUvarint()
+	if err != nil {
+		return nil, fmt.Errorf("reading header failed: %w", err)
+	}
+	if version != indexVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrIndexFormat, version)
+	}
+
+	count, err := readUvarint()
+	if err != nil {
+		return nil, fmt.Errorf("reading words failed: %w", err)
+	}
+	if sized, ok := r.(interface{ Len() int }); ok && count > (br.Buffered()+sized.Len())/indexWordSize {
+		return nil, fmt.Errorf("%w: %d words exceed the input", ErrIndexFormat, count)
+	}
+	// words are appended as they are read, so a damaged count does not allocate memory up front
+	capacity := count
+	if capacity > 4096 {
+		capacity = 4096
+	}
+	words := make([]indexedWord, 0, capacity)
+	for i := 0; i < count; i++ {
+		var w indexedWord
+		for _, v := range []*int{&w.n, &w.length, &w.posS, &w.posE} {
+			if *v, err = readUvarint(); err != nil {
+				return nil, fmt.Errorf("reading words failed: %w", err)
+			}
+		}
+		words = append(words, w)
+	}
+
+	sa := &suffixarray.Index{}
+	if err := sa.Read(br); err != nil {
+		return nil, fmt.Errorf("reading suffix array failed: %w", err)
+	}
+
+	text := sa.Bytes()
+	for i, w := range words {
+		if w.n+w.length > len(text) || w.posS > w.posE || (i > 0 && w.n <= words[i-1].n) {
+			return nil, fmt.Errorf("%w: word %d out of indexed text", ErrIndexFormat, i)
+		}
+	}
+
+	return &Index{words: words, sa: sa}, nil
+}
+
+// covers tells whether positions of indexed words lie within content of given length
+func (ix *Index) covers(contentLen int) bool {
+	for _, w := range ix.words {
+		if w.posE > contentLen {
+			return false
+		}
+	}
+	return true
+}
+
+// IndexStore persists serialized indexes keyed by fingerprint of indexed content, eg. in a cache of their own
+type IndexStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+type indexSearcher struct {
+	randomResult bool
+	store        IndexStore // optional
+	indexes      *memo      // key: content fingerprint
+}
+
+func (s *indexSearcher) index(content string) *Index {
+	key := fingerprint(content)
+
+	if ix, ok := s.indexes.Get(key); ok {
+		return ix.(*Index)
+	}
+
+	if s.store != nil {
+		if raw, ok := s.store.Get(key); ok {
+			ix, err := ReadIndex(bytes.NewReader(raw))
+			if err == nil && ix.covers(len(content)) {
+				s.indexes.Set(key, ix)
+				return ix
+			}
+		}
+	}
+
+	ix := NewIndex(content)
+	if s.store != nil {
+		var buf bytes.Buffer
+		if err := ix.Write(&buf); err == nil {
+			s.store.Set(key, buf.Bytes())
+		}
+	}
+	s.indexes.Set(key, ix)
+	return ix
+}
+
+func (s *indexSearcher) Search(content string, phrase string, opts Options) (Result, error) {
+	return pick(content, s.index(content).Lookup(phrase, opts), s.randomResult)
+}
+
+// NewIndexSearcher returns Searcher backed by suffix array index of searched content. Indexes are built once per
+// content and reused, store is optional and allows to keep serialized indexes outside of the process.
+func NewIndexSearcher(randomResult bool, store IndexStore) Searcher {
+	if randomResult {
+		rand.Seed(time.Now().UnixNano())
+	}
+
+	return &indexSearcher{
+		randomResult: randomResult,
+		store:        store,
+		indexes:      newMemo(memoSize),
+	}
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"index/suffixarray"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTestBook(t *testing.T) string {
+	content, err := ioutil.ReadFile("search_test_book_content.txt")
+	if err != nil {
+		t.Fatal("Failed to read test book: ", err)
+	}
+	return string(content)
+}
+
+func TestIndexLookup(t *testing.T) {
+	type testCase struct {
+		phrase      string
+		maxDistance int
+		minMatched  float64 // default options if 0
+		stopWords   string  // default options if empty
+		expected    string  // first match
+	}
+
+	testCases := []testCase{
+		{phrase: "wherefore art thou Romeo", maxDistance: 0, expected: "wherefore art thou Romeo?"},
+		{phrase: "WHEREFORE   art\nthou romeo", maxDistance: 0, expected: "wherefore art thou Romeo?"},
+		{phrase: "wherfore art thou romeo", maxDistance: 1, expected: "wherefore art thou Romeo?"},
+		{phrase: "denie thy father and refuse", maxDistance: 0, expected: "Denie thy Father and refuse"},
+		{phrase: "deny thy father and refuse", maxDistance: 2, expected: "Denie thy Father and refuse"},
+		{phrase: "wherfore art thou romeo", maxDistance: 0, minMatched: 0.75, expected: "wherefore art thou Romeo?"},
+		{phrase: "denie thy father or refuse", maxDistance: 0, stopWords: StopWordsIgnore,
+			expected: "Denie thy Father and refuse"},
+	}
+
+	content := loadTestBook(t)
+	index := NewIndex(content)
+
+	for _, tc := range testCases {
+		name := fmt.Sprintf("phrase:'%s'", tc.phrase)
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.MaxDistance = tc.maxDistance
+			if tc.minMatched > 0 {
+				opts.MinMatchedFraction = tc.minMatched
+			}
+			if tc.stopWords != "" {
+				opts.StopWords = tc.stopWords
+			}
+			found := index.Lookup(tc.phrase, opts)
+			if assert.NotEmpty(t, found) {
+				assert.Equal(t, tc.expected, content[found[0].a:found[0].b])
+			}
+		})
+	}
+}
+
+func TestIndexLookupNotFound(t *testing.T) {
+	type testCase struct {
+		phrase      string
+		maxDistance int
+	}
+
+	testCases := []testCase{
+		{phrase: "", maxDistance: 2},
+		{phrase: "wherfore art thou romeo", maxDistance: 0},
+		{phrase: "to be or not to be", maxDistance: 0},
+		{phrase: "xyzzy qwerty", maxDistance: 2},
+	}
+
+	index := NewIndex(loadTestBook(t))
+
+	for _, tc := range testCases {
+		name := fmt.Sprintf("phrase:'%s'", tc.phrase)
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.MaxDistance = tc.maxDistance
+			assert.Empty(t, index.Lookup(tc.phrase, opts))
+		})
+	}
+}
+
+func TestIndexSerialization(t *testing.T) {
+	content := loadTestBook(t)
+	index := NewIndex(content)
+
+	var buf bytes.Buffer
+	assert.Nil(t, index.Write(&buf))
+
+	loaded, err := ReadIndex(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, index.Lookup("o romeo romeo", DefaultOptions()), loaded.Lookup("o romeo romeo", DefaultOptions()))
+
+	_, err = ReadIndex(bytes.NewBufferString("not an index"))
+	assert.NotNil(t, err)
+}
+
+func TestReadIndexDamaged(t *testing.T) {
+	var valid bytes.Buffer
+	assert.Nil(t, NewIndex("O Romeo, Romeo! wherefore art thou Romeo?").Write(&valid))
+
+	var outOfText bytes.Buffer
+	damaged := &Index{words: []indexedWord{{n: 100, length: 5}}, sa: suffixarray.New([]byte("romeo"))}
+	assert.Nil(t, damaged.Write(&outOfText))
+
+	hugeCount := append([]byte(indexMagic), 1)
+	hugeCount = append(hugeCount, 0xff, 0xff, 0xff, 0xff, 0x07)
+
+	type testCase struct {
+		description string
+		raw         []byte
+	}
+
+	testCases := []testCase{
+		{description: "truncated", raw: valid.Bytes()[:valid.Len()/2]},
+		{description: "word out of text", raw: outOfText.Bytes()},
+		{description: "huge word count", raw: hugeCount},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("input:'%s'", tc.description), func(t *testing.T) {
+			_, err := ReadIndex(bytes.NewReader(tc.raw))
+			assert.NotNil(t, err)
+		})
+	}
+
+	_, err := ReadIndex(bytes.NewReader(outOfText.Bytes()))
+	assert.True(t, errors.Is(err, ErrIndexFormat))
+	_, err = ReadIndex(bytes.NewReader(hugeCount))
+	assert.True(t, errors.Is(err, ErrIndexFormat))
+}
+
+// indexStoreMock keeps serialized indexes in memory
+type indexStoreMock map[string][]byte
+
+func (s indexStoreMock) Get(key string) ([]byte, bool) {
+	raw, ok := s[key]
+	return raw, ok
+}
+
+func (s indexStoreMock) Set(key string, value []byte) {
+	s[key] = value
+}
+
+func TestIndexSearcherStore(t *testing.T) {
+	content := loadTestBook(t)
+	store := indexStoreMock{}
+
+	expected, err := NewIndexSearcher(false, store).Search(content, "wherefore art thou Romeo", DefaultOptions())
+	assert.Nil(t, err)
+	if assert.Len(t, store, 1) {
+		// stored under collision resistant fingerprint of the content
+		assert.Contains(t, store, fingerprint(content))
+		assert.Len(t, fingerprint(content), 64)
+	}
+
+	// stored index is reused by another searcher
+	result, err := NewIndexSearcher(false, store).Search(content, "wherefore art thou Romeo", DefaultOptions())
+	assert.Nil(t, err)
+	assert.Equal(t, expected, result)
+
+	// index not covering the content is rebuilt
+	short := "O Romeo, Romeo! wherefore art thou Romeo?"
+	var foreign bytes.Buffer
+	assert.Nil(t, NewIndex(content).Write(&foreign))
+	store[fingerprint(short)] = foreign.Bytes()
+	result, err = NewIndexSearcher(false, store).Search(short, "wherefore art thou Romeo", DefaultOptions())
+	assert.Nil(t, err)
+	assert.Equal(t, "wherefore art thou Romeo?", result.Phrase)
+}
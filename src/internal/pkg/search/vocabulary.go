@@ -0,0 +1,44 @@
+package search
+
+// vocabulary maps every unique normalized word of a book to its positions, words are kept in BK-tree so fuzzy
+// candidates of a phrase word can be found without scanning whole book
+type vocabulary struct {
+	tree      *bkTree
+	positions map[string][]int // key: normalized word, value: indexes of words
+	words     []string         // normalized words in order of appearance
+	indexes   []Indexes        // position of words in original content
+}
+
+func newVocabulary(content string) *vocabulary {
+	fields, indexes := BookFields(content, len(content)/6)
+
+	v := &vocabulary{
+		tree:      &bkTree{},
+		positions: make(map[string][]int),
+		words:     make([]string, 0, len(fields)),
+		indexes:   make([]Indexes, 0, len(fields)),
+	}
+
+	for i, field := range fields {
+		word := normalizeWord(field)
+		if word == "" {
+			continue
+		}
+		if _, ok := v.positions[word]; !ok {
+			v.tree.Add(word)
+		}
+		v.positions[word] = append(v.positions[word], len(v.words))
+		v.words = append(v.words, word)
+		v.indexes = append(v.indexes, indexes[i])
+	}
+	return v
+}
+
+// candidates returns positions of all words that are not further than maxDistance from given word
+func (v *vocabulary) candidates(word string, maxDistance int) []int {
+	var positions []int
+	for _, similar := range v.tree.Find(word, maxDistance) {
+		positions = append(positions, v.positions[similar]...)
+	}
+	return positions
+}
@@ -0,0 +1,36 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+// normalizeWord lower-cases given word and strips punctuation from its boundaries, eg. "Romeo," -> "romeo"
+func normalizeWord(s string) string {
+	return strings.ToLower(strings.TrimFunc(s, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSymbol(r)
+	}))
+}
+
+// normalizeWords splits phrase into normalized words, words consisted of punctuation only are dropped
+func normalizeWords(phrase string) []string {
+	var words []string
+	for _, field := range strings.Fields(phrase) {
+		word := normalizeWord(field)
+		if word == "" {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// wordDistance returns Levenshtein distance between two already normalized words
+func wordDistance(a, b string) int {
+	if a == b {
+		return 0
+	}
+	return fuzzy.LevenshteinDistance(a, b)
+}